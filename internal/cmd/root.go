@@ -24,21 +24,29 @@ var (
 			for viperKey, cobraFlag := range map[string]string{
 				"grpc.host":             "grpc-host",
 				"grpc.port":             "grpc-port",
+				"grpc.maxRecvMsgSize":   "grpc-max-recv-msg-size",
+				"grpc.maxSendMsgSize":   "grpc-max-send-msg-size",
 				"server.host":           "server-host",
 				"server.port":           "server-port",
 				"prom.host":             "prom-host",
 				"prom.port":             "prom-port",
 				"proxyEndpoint":         "enable-proxy-endpoint",
 				"proxyAllowRegexp":      "proxy-allow-regexp",
+				"redirectAllowRegexp":   "redirect-allow-regexp",
+				"compression":           "enable-compression",
 				"awsMetadataEndpoint":   "aws-metadata-endpoint",
 				"drainTimeout":          "drain-timeout",
 				"maxDelay":              "max-delay",
+				"maxBytesSize":          "max-bytes-size",
+				"maxBodySize":           "max-body-size",
 				"httpWriteTimeout":      "http-write-timeout",
 				"httpReadTimeout":       "http-read-timeout",
 				"httpIdleTimeout":       "http-idle-timeout",
 				"httpReadHeaderTimeout": "http-read-header-timeout",
 				"intermittentErrors":    "intermittent-errors",
 				"egressTimeout":         "egress-timeout",
+				"egressTCPAllowRegexp":  "egress-tcp-allow-regexp",
+				"trustedProxies":        "trusted-proxies",
 			} {
 				if err := viper.BindPFlag(viperKey, cmd.Flags().Lookup(cobraFlag)); err != nil {
 					return err
@@ -66,21 +74,29 @@ func init() {
 
 	rootCmd.Flags().IP("grpc-host", net.ParseIP(infrabin.DefaultHost), "gRPC host")
 	rootCmd.Flags().Uint("grpc-port", infrabin.DefaultGRPCPort, "gRPC port")
+	rootCmd.Flags().Int("grpc-max-recv-msg-size", infrabin.GRPCMaxRecvMsgSize, "Maximum size in bytes of the messages received by the gRPC server")
+	rootCmd.Flags().Int("grpc-max-send-msg-size", infrabin.GRPCMaxSendMsgSize, "Maximum size in bytes of the messages sent by the gRPC server")
 	rootCmd.Flags().IP("server-host", net.ParseIP(infrabin.DefaultHost), "HTTP server host")
 	rootCmd.Flags().Uint("server-port", infrabin.DefaultHTTPServerPort, "HTTP server port")
 	rootCmd.Flags().IP("prom-host", net.ParseIP(infrabin.DefaultHost), "Prometheus metrics host")
 	rootCmd.Flags().Uint("prom-port", infrabin.DefaultPrometheusPort, "Prometheus metrics port")
 	rootCmd.Flags().Bool("enable-proxy-endpoint", infrabin.EnableProxyEndpoint, "When enabled allows /proxy and /aws endpoints")
 	rootCmd.Flags().String("proxy-allow-regexp", infrabin.ProxyAllowRegexp, "Regexp to allow URLs via /proxy endpoint")
+	rootCmd.Flags().String("redirect-allow-regexp", infrabin.RedirectAllowRegexp, "Regexp to allow URLs via /redirect-to endpoint")
+	rootCmd.Flags().Bool("enable-compression", infrabin.EnableCompression, "When enabled compresses the responses with the encoding negotiated from Accept-Encoding (zstd, br, gzip or deflate)")
 	rootCmd.Flags().String("aws-metadata-endpoint", infrabin.AWSMetadataEndpoint, "AWS Metadata Endpoint")
 	rootCmd.Flags().Duration("drain-timeout", infrabin.DrainTimeout, "Drain timeout")
 	rootCmd.Flags().Duration("max-delay", infrabin.MaxDelay, "Maximum delay")
+	rootCmd.Flags().Int64("max-bytes-size", infrabin.MaxBytesSize, "Maximum number of bytes generated by the /bytes endpoint and the RandomData and Payload RPCs")
+	rootCmd.Flags().Int64("max-body-size", infrabin.MaxBodySize, "Maximum size in bytes of the request bodies echoed by the /anything endpoint, larger bodies are rejected with 413")
 	rootCmd.Flags().Duration("http-write-timeout", infrabin.HTTPWriteTimeout, "HTTP write timeout")
 	rootCmd.Flags().Duration("http-read-timeout", infrabin.HTTPReadTimeout, "HTTP read timeout")
 	rootCmd.Flags().Duration("http-idle-timeout", infrabin.HTTPIdleTimeout, "HTTP idle timeout")
 	rootCmd.Flags().Duration("http-read-header-timeout", infrabin.HTTPReadHeaderTimeout, "HTTP read header timeout")
 	rootCmd.Flags().Int32("intermittent-errors", infrabin.IntermittentErrors, "Consecutive 503 errors before returning 200 for the /intermittent endpoint")
-	rootCmd.Flags().Duration("egress-timeout", infrabin.EgressTimeout, "Timeout for egress HTTP/HTTPS requests")
+	rootCmd.Flags().Duration("egress-timeout", infrabin.EgressTimeout, "Timeout for egress HTTP/HTTPS requests and TCP connections")
+	rootCmd.Flags().String("egress-tcp-allow-regexp", infrabin.EgressTCPAllowRegexp, "Regexp to allow the host:port targets the /egress/tcp endpoint can send a payload to")
+	rootCmd.Flags().StringSlice("trusted-proxies", nil, "CIDRs or IPs of the proxies trusted to set the client IP in the X-Forwarded-For, Forwarded and X-Real-IP headers")
 }
 
 func run(cmd *cobra.Command, args []string) {
@@ -104,6 +120,9 @@ func run(cmd *cobra.Command, args []string) {
 		"server",
 		infrabin.RegisterInfrabin("/", grpcServer.InfrabinService),
 		infrabin.RegisterOpenAPI("/openapi.json"),
+		infrabin.RegisterConnectionFaults("/connection/"),
+		infrabin.RegisterWebSocket("/ws"),
+		infrabin.RegisterSSE("/sse"),
 	)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Failed to initialize HTTP server: %v\n", err)
@@ -0,0 +1,109 @@
+package infrabin
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+	"unicode/utf8"
+
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// Anything echoes back the request. Requests from the gateway are described from the original HTTP request,
+// gRPC requests from their metadata and peer.
+func (s *InfrabinService) Anything(ctx context.Context, request *AnythingRequest) (*Response, error) {
+	var response *AnythingResponse
+	if r, ok := httpRequestFromContext(ctx); ok {
+		response = describeHTTPRequest(r)
+	} else {
+		response = describeGRPCRequest(ctx)
+	}
+
+	data := request.GetBody().GetData()
+	if len(data) > 0 {
+		contentType := request.GetBody().GetContentType()
+		if contentType == "" {
+			contentType = response.Headers["Content-Type"]
+		}
+		describeBody(response, contentType, data)
+	}
+	return &Response{Anything: response}, nil
+}
+
+// describeHTTPRequest describes the HTTP request, except for its body
+func describeHTTPRequest(r *http.Request) *AnythingResponse {
+	response := &AnythingResponse{
+		Method:     r.Method,
+		Url:        requestScheme(r) + "://" + r.Host + r.URL.RequestURI(),
+		Args:       joinValues(r.URL.Query()),
+		Headers:    joinValues(r.Header),
+		RemoteAddr: peerAddr(r),
+		Proto:      r.Proto,
+	}
+	// The Go HTTP server removes the Host header from the request headers
+	response.Headers["Host"] = r.Host
+	return response
+}
+
+// requestScheme returns the scheme of the request, as set by the proxy headers, or from the connection
+func requestScheme(r *http.Request) string {
+	if r.URL.Scheme != "" {
+		return r.URL.Scheme
+	}
+	if r.TLS != nil {
+		return "https"
+	}
+	return "http"
+}
+
+// describeGRPCRequest describes the gRPC request, except for its body
+func describeGRPCRequest(ctx context.Context) *AnythingResponse {
+	md, _ := metadata.FromIncomingContext(ctx)
+	response := &AnythingResponse{
+		Method:  http.MethodPost,
+		Url:     "grpc://" + strings.Join(md.Get(":authority"), ",") + "/" + Infrabin_ServiceDesc.ServiceName + "/Anything",
+		Headers: joinValues(md),
+		Proto:   "HTTP/2.0",
+	}
+	if p, ok := peer.FromContext(ctx); ok {
+		response.RemoteAddr = p.Addr.String()
+	}
+	return response
+}
+
+// describeBody sets the raw body of the response, and the parsed body when it is JSON or form data
+func describeBody(response *AnythingResponse, contentType string, data []byte) {
+	if utf8.Valid(data) {
+		response.Data = string(data)
+	} else {
+		response.Data = "data:application/octet-stream;base64," + base64.StdEncoding.EncodeToString(data)
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	switch {
+	case mediaType == "application/json" || strings.HasSuffix(mediaType, "+json"):
+		var value any
+		if err := json.Unmarshal(data, &value); err == nil {
+			response.Json, _ = structpb.NewValue(value)
+		}
+	case mediaType == "application/x-www-form-urlencoded":
+		if form, err := url.ParseQuery(string(data)); err == nil {
+			response.Form = joinValues(form)
+		}
+	}
+}
+
+// joinValues joins the multiple values of each key with a comma
+func joinValues[M ~map[string][]string](values M) map[string]string {
+	result := make(map[string]string, len(values))
+	for key, value := range values {
+		result[key] = strings.Join(value, ",")
+	}
+	return result
+}
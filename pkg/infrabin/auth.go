@@ -0,0 +1,171 @@
+package infrabin
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"net/http"
+	"strings"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// AuthRealm is the realm of the WWW-Authenticate challenges
+const AuthRealm = "go-infrabin"
+
+// Quality of protection values of the Digest scheme
+const (
+	DigestQopAuth    = "auth"
+	DigestQopAuthInt = "auth-int"
+)
+
+// BasicAuth authenticates the request with the Basic scheme.
+func (s *InfrabinService) BasicAuth(ctx context.Context, request *BasicAuthRequest) (*Response, error) {
+	user, passwd, ok := (&http.Request{Header: http.Header{"Authorization": {authorization(ctx)}}}).BasicAuth()
+	if !ok || !secureEqual(user, request.User) || !secureEqual(passwd, request.Passwd) {
+		return nil, authChallenge(ctx, fmt.Sprintf("Basic realm=%q", AuthRealm))
+	}
+	return &Response{Auth: &AuthResponse{Authenticated: true, Scheme: "Basic", User: user}}, nil
+}
+
+// Bearer authenticates the request with the Bearer scheme, accepting any token.
+func (s *InfrabinService) Bearer(ctx context.Context, _ *Empty) (*Response, error) {
+	scheme, token, _ := strings.Cut(authorization(ctx), " ")
+	token = strings.TrimSpace(token)
+	if !strings.EqualFold(scheme, "Bearer") || token == "" {
+		return nil, authChallenge(ctx, fmt.Sprintf("Bearer realm=%q", AuthRealm))
+	}
+	return &Response{Auth: &AuthResponse{Authenticated: true, Scheme: "Bearer", Token: token}}, nil
+}
+
+// DigestAuth authenticates the request with the Digest scheme, as defined by RFC 7616.
+// The nonces are not tracked, so any nonce sent back by the client is accepted.
+func (s *InfrabinService) DigestAuth(ctx context.Context, request *DigestAuthRequest) (*Response, error) {
+	if request.Qop != DigestQopAuth && request.Qop != DigestQopAuthInt {
+		return nil, status.Errorf(codes.InvalidArgument, "qop must be %s or %s", DigestQopAuth, DigestQopAuthInt)
+	}
+	algorithm := strings.ToUpper(request.Algorithm)
+	if algorithm == "" {
+		algorithm = "MD5"
+	}
+	if _, ok := digestAlgorithms[algorithm]; !ok {
+		return nil, status.Errorf(codes.InvalidArgument, "algorithm must be MD5 or SHA-256")
+	}
+
+	if params, ok := parseDigestAuthorization(authorization(ctx)); ok && verifyDigest(ctx, request, algorithm, params) {
+		return &Response{Auth: &AuthResponse{Authenticated: true, Scheme: "Digest", User: request.User}}, nil
+	}
+	return nil, authChallenge(ctx, fmt.Sprintf("Digest realm=%q, qop=%q, nonce=%q, opaque=%q, algorithm=%s",
+		AuthRealm, request.Qop, rand.Text(), rand.Text(), algorithm))
+}
+
+// digestAlgorithms maps the supported Digest algorithms to their hash functions
+var digestAlgorithms = map[string]func() hash.Hash{
+	"MD5":     md5.New,
+	"SHA-256": sha256.New,
+}
+
+// verifyDigest checks the response of the Digest Authorization parameters against the expected credentials
+func verifyDigest(ctx context.Context, request *DigestAuthRequest, algorithm string, params map[string]string) bool {
+	for _, name := range []string{"nonce", "nc", "cnonce", "uri", "response"} {
+		if params[name] == "" {
+			return false
+		}
+	}
+	if params["username"] != request.User || params["realm"] != AuthRealm || params["qop"] != request.Qop {
+		return false
+	}
+	if params["algorithm"] != "" && !strings.EqualFold(params["algorithm"], algorithm) {
+		return false
+	}
+
+	// gRPC requests have no HTTP method, and their body is the request message, so they digest an empty body
+	method := http.MethodPost
+	if r, ok := httpRequestFromContext(ctx); ok {
+		if params["uri"] != r.URL.RequestURI() {
+			return false
+		}
+		method = r.Method
+	}
+
+	digest := func(values ...string) string {
+		h := digestAlgorithms[algorithm]()
+		h.Write([]byte(strings.Join(values, ":")))
+		return hex.EncodeToString(h.Sum(nil))
+	}
+	ha1 := digest(request.User, AuthRealm, request.Passwd)
+	ha2 := digest(method, params["uri"])
+	if request.Qop == DigestQopAuthInt {
+		ha2 = digest(method, params["uri"], digest(""))
+	}
+	expected := digest(ha1, params["nonce"], params["nc"], params["cnonce"], request.Qop, ha2)
+	return secureEqual(params["response"], expected)
+}
+
+// parseDigestAuthorization parses the parameters of a Digest Authorization header,
+// e.g. `Digest username="user", realm="go-infrabin", nc=00000001`
+func parseDigestAuthorization(value string) (map[string]string, bool) {
+	scheme, rest, _ := strings.Cut(value, " ")
+	if !strings.EqualFold(scheme, "Digest") {
+		return nil, false
+	}
+
+	params := make(map[string]string)
+	for rest = strings.TrimSpace(rest); rest != ""; rest = strings.TrimLeft(rest, " ,") {
+		name, after, ok := strings.Cut(rest, "=")
+		if !ok {
+			return nil, false
+		}
+		name = strings.ToLower(strings.TrimSpace(name))
+		after = strings.TrimSpace(after)
+
+		if !strings.HasPrefix(after, `"`) {
+			token, next, _ := strings.Cut(after, ",")
+			params[name] = strings.TrimSpace(token)
+			rest = next
+			continue
+		}
+		// Quoted string, with backslash escapes
+		var b strings.Builder
+		i := 1
+		for ; i < len(after) && after[i] != '"'; i++ {
+			if after[i] == '\\' && i+1 < len(after) {
+				i++
+			}
+			b.WriteByte(after[i])
+		}
+		if i == len(after) {
+			return nil, false
+		}
+		params[name] = b.String()
+		rest = after[i+1:]
+	}
+	return params, true
+}
+
+// authorization returns the Authorization header of the request, from the gateway or gRPC metadata
+func authorization(ctx context.Context) string {
+	md, _ := metadata.FromIncomingContext(ctx)
+	if values := md.Get("authorization"); len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+// authChallenge returns an Unauthorized error with the WWW-Authenticate challenge as message.
+// The gateway sends the message of codes.Unauthenticated errors as the WWW-Authenticate header.
+func authChallenge(ctx context.Context, challenge string) error {
+	return httpStatusError(ctx, http.StatusUnauthorized, "%s", challenge)
+}
+
+// secureEqual compares the strings in constant time
+func secureEqual(a string, b string) bool {
+	return subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
+}
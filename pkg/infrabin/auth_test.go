@@ -0,0 +1,201 @@
+package infrabin
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+func TestBasicAuthHandler(t *testing.T) {
+	testCases := []struct {
+		name           string
+		user           string
+		passwd         string
+		expectedStatus int
+	}{
+		{name: "valid credentials", user: "user", passwd: "passwd", expectedStatus: http.StatusOK},
+		{name: "wrong password", user: "user", passwd: "wrong", expectedStatus: http.StatusUnauthorized},
+		{name: "wrong user", user: "other", passwd: "passwd", expectedStatus: http.StatusUnauthorized},
+		{name: "no credentials", expectedStatus: http.StatusUnauthorized},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/basic-auth/user/passwd", nil)
+			if tc.user != "" {
+				req.SetBasicAuth(tc.user, tc.passwd)
+			}
+			rr := httptest.NewRecorder()
+			handler := newHTTPInfrabinHandler()
+			handler.ServeHTTP(rr, req)
+
+			if rr.Code != tc.expectedStatus {
+				t.Fatalf("handler returned wrong status code: got %v want %v: %s", rr.Code, tc.expectedStatus, rr.Body.String())
+			}
+			if tc.expectedStatus == http.StatusUnauthorized {
+				if got, want := rr.Header().Get("WWW-Authenticate"), `Basic realm="go-infrabin"`; got != want {
+					t.Errorf("WWW-Authenticate = %q, want %q", got, want)
+				}
+				return
+			}
+			var got Response
+			if err := protojson.Unmarshal(rr.Body.Bytes(), &got); err != nil {
+				t.Fatalf("failed to parse response %v: %v", rr.Body.String(), err)
+			}
+			if !got.Auth.GetAuthenticated() || got.Auth.GetUser() != "user" || got.Auth.GetScheme() != "Basic" {
+				t.Errorf("unexpected auth response: %v", got.Auth)
+			}
+		})
+	}
+}
+
+func TestBearerHandler(t *testing.T) {
+	testCases := []struct {
+		name           string
+		authorization  string
+		expectedStatus int
+	}{
+		{name: "token", authorization: "Bearer abc.def", expectedStatus: http.StatusOK},
+		{name: "lowercase scheme", authorization: "bearer abc.def", expectedStatus: http.StatusOK},
+		{name: "empty token", authorization: "Bearer ", expectedStatus: http.StatusUnauthorized},
+		{name: "basic scheme", authorization: "Basic dXNlcjpwYXNzd2Q=", expectedStatus: http.StatusUnauthorized},
+		{name: "no authorization", expectedStatus: http.StatusUnauthorized},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/bearer", nil)
+			if tc.authorization != "" {
+				req.Header.Set("Authorization", tc.authorization)
+			}
+			rr := httptest.NewRecorder()
+			handler := newHTTPInfrabinHandler()
+			handler.ServeHTTP(rr, req)
+
+			if rr.Code != tc.expectedStatus {
+				t.Fatalf("handler returned wrong status code: got %v want %v: %s", rr.Code, tc.expectedStatus, rr.Body.String())
+			}
+			if tc.expectedStatus == http.StatusUnauthorized {
+				if got, want := rr.Header().Get("WWW-Authenticate"), `Bearer realm="go-infrabin"`; got != want {
+					t.Errorf("WWW-Authenticate = %q, want %q", got, want)
+				}
+				return
+			}
+			var got Response
+			if err := protojson.Unmarshal(rr.Body.Bytes(), &got); err != nil {
+				t.Fatalf("failed to parse response %v: %v", rr.Body.String(), err)
+			}
+			if !got.Auth.GetAuthenticated() || got.Auth.GetToken() != "abc.def" {
+				t.Errorf("unexpected auth response: %v", got.Auth)
+			}
+		})
+	}
+}
+
+// digestAuthorization answers the Digest challenge like a client would
+func digestAuthorization(t *testing.T, challenge string, method string, uri string, user string, passwd string) string {
+	t.Helper()
+	params, ok := parseDigestAuthorization(challenge)
+	if !ok {
+		t.Fatalf("failed to parse challenge %q", challenge)
+	}
+	newHash := map[string]func() hash.Hash{"MD5": md5.New, "SHA-256": sha256.New}[params["algorithm"]]
+	digest := func(values ...string) string {
+		h := newHash()
+		h.Write([]byte(strings.Join(values, ":")))
+		return hex.EncodeToString(h.Sum(nil))
+	}
+	ha1 := digest(user, params["realm"], passwd)
+	ha2 := digest(method, uri)
+	if params["qop"] == DigestQopAuthInt {
+		ha2 = digest(method, uri, digest(""))
+	}
+	response := digest(ha1, params["nonce"], "00000001", "0a4f113b", params["qop"], ha2)
+	return fmt.Sprintf(`Digest username="%s", realm="%s", nonce="%s", uri="%s", algorithm=%s, qop=%s, nc=00000001, cnonce="0a4f113b", response="%s", opaque="%s"`,
+		user, params["realm"], params["nonce"], uri, params["algorithm"], params["qop"], response, params["opaque"])
+}
+
+func TestDigestAuthHandler(t *testing.T) {
+	testCases := []struct {
+		name           string
+		path           string
+		passwd         string
+		expectedStatus int
+	}{
+		{name: "auth", path: "/digest-auth/auth/user/passwd", passwd: "passwd", expectedStatus: http.StatusOK},
+		{name: "auth-int", path: "/digest-auth/auth-int/user/passwd", passwd: "passwd", expectedStatus: http.StatusOK},
+		{name: "sha-256", path: "/digest-auth/auth/user/passwd?algorithm=SHA-256", passwd: "passwd", expectedStatus: http.StatusOK},
+		{name: "wrong password", path: "/digest-auth/auth/user/passwd", passwd: "wrong", expectedStatus: http.StatusUnauthorized},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			handler := newHTTPInfrabinHandler()
+
+			// The first request gets the challenge
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, httptest.NewRequest("GET", tc.path, nil))
+			if rr.Code != http.StatusUnauthorized {
+				t.Fatalf("handler returned wrong status code: got %v want %v: %s", rr.Code, http.StatusUnauthorized, rr.Body.String())
+			}
+			challenge := rr.Header().Get("WWW-Authenticate")
+
+			req := httptest.NewRequest("GET", tc.path, nil)
+			req.Header.Set("Authorization", digestAuthorization(t, challenge, "GET", tc.path, "user", tc.passwd))
+			rr = httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			if rr.Code != tc.expectedStatus {
+				t.Fatalf("handler returned wrong status code: got %v want %v: %s", rr.Code, tc.expectedStatus, rr.Body.String())
+			}
+			if tc.expectedStatus != http.StatusOK {
+				return
+			}
+			var got Response
+			if err := protojson.Unmarshal(rr.Body.Bytes(), &got); err != nil {
+				t.Fatalf("failed to parse response %v: %v", rr.Body.String(), err)
+			}
+			if !got.Auth.GetAuthenticated() || got.Auth.GetUser() != "user" || got.Auth.GetScheme() != "Digest" {
+				t.Errorf("unexpected auth response: %v", got.Auth)
+			}
+		})
+	}
+}
+
+func TestDigestAuthHandlerInvalid(t *testing.T) {
+	for _, path := range []string{"/digest-auth/invalid/user/passwd", "/digest-auth/auth/user/passwd?algorithm=SHA-1"} {
+		rr := httptest.NewRecorder()
+		handler := newHTTPInfrabinHandler()
+		handler.ServeHTTP(rr, httptest.NewRequest("GET", path, nil))
+
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("%s returned wrong status code: got %v want %v", path, rr.Code, http.StatusBadRequest)
+		}
+	}
+}
+
+func TestParseDigestAuthorization(t *testing.T) {
+	params, ok := parseDigestAuthorization(`Digest username="us\"er", realm="go-infrabin",nc=00000001, qop=auth, uri="/a,b"`)
+	if !ok {
+		t.Fatalf("parseDigestAuthorization() failed")
+	}
+	expected := map[string]string{"username": `us"er`, "realm": "go-infrabin", "nc": "00000001", "qop": "auth", "uri": "/a,b"}
+	for name, value := range expected {
+		if params[name] != value {
+			t.Errorf("%s = %q, want %q", name, params[name], value)
+		}
+	}
+	for _, value := range []string{`Basic dXNlcg==`, `Digest username="unterminated`, `Digest invalid`} {
+		if _, ok := parseDigestAuthorization(value); ok {
+			t.Errorf("parseDigestAuthorization(%q) succeeded, want failure", value)
+		}
+	}
+}
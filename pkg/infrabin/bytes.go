@@ -0,0 +1,242 @@
+package infrabin
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	mathrand "math/rand/v2"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/spf13/viper"
+	"google.golang.org/genproto/googleapis/api/httpbody"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// BytesChunkSize is the size of the chunks streamed by the Bytes RPC, and the default of the StreamBytes RPC
+const BytesChunkSize = 64 << 10
+
+// MaxStreamChunkSize is the maximum size of the chunks streamed by the StreamBytes RPC
+const MaxStreamChunkSize = 1 << 20
+
+// MaxRandomDataSize is the maximum size of the RandomData RPC, lower than the maxBytesSize configuration
+// as the bytes are returned in a single message, base64-encoded in the JSON of /bytes/{n}
+const MaxRandomDataSize = 4 << 20
+
+// Trailers reporting the throughput of the StreamBytes RPC
+const (
+	BytesTrailer      = "X-Bytes"
+	ElapsedTrailer    = "X-Elapsed"
+	ThroughputTrailer = "X-Throughput"
+)
+
+// RequestIDHeader is the header of the request ID logged with the throughput of the StreamBytes RPC,
+// which proxies that drop the trailers still forward. The gateway generates it when the request has none,
+// and sends it back as a response header.
+const RequestIDHeader = "X-Request-Id"
+
+// Bytes streams request.N random bytes in chunks of BytesChunkSize, so that the memory used
+// does not depend on the number of bytes requested.
+func (s *InfrabinService) Bytes(request *BytesRequest, stream grpc.ServerStreamingServer[httpbody.HttpBody]) error {
+	if err := validateBytesSize(request.N); err != nil {
+		return err
+	}
+	random := randomReader(request.Seed)
+	for remaining := request.N; remaining > 0; {
+		chunk := make([]byte, min(remaining, BytesChunkSize))
+		if _, err := io.ReadFull(random, chunk); err != nil {
+			return status.Errorf(codes.Internal, "failed to generate random data: %v", err)
+		}
+		if err := stream.Send(&httpbody.HttpBody{ContentType: "application/octet-stream", Data: chunk}); err != nil {
+			return err
+		}
+		remaining -= int64(len(chunk))
+	}
+	return nil
+}
+
+// StreamBytes streams request.N random bytes, throttled to request.Rate, in chunks of request.ChunkSize.
+// The bytes sent, the elapsed time and the achieved throughput in bytes per second are logged
+// with the request ID, and sent as trailers.
+func (s *InfrabinService) StreamBytes(request *StreamBytesRequest, stream grpc.ServerStreamingServer[httpbody.HttpBody]) error {
+	if err := validateBytesSize(request.N); err != nil {
+		return err
+	}
+	rate, err := requestRate(request.Rate)
+	if err != nil {
+		return err
+	}
+	chunkSize := int64(request.ChunkSize)
+	switch {
+	case chunkSize == 0:
+		chunkSize = throttledChunkSize(rate)
+	case chunkSize < 0 || chunkSize > MaxStreamChunkSize:
+		return status.Errorf(codes.InvalidArgument, "chunk_size must be between 1 and %d", MaxStreamChunkSize)
+	}
+
+	random := randomReader(request.Seed)
+	start := time.Now()
+	var sent int64
+	for sent < request.N {
+		chunk := make([]byte, min(request.N-sent, chunkSize))
+		if _, err := io.ReadFull(random, chunk); err != nil {
+			return status.Errorf(codes.Internal, "failed to generate random data: %v", err)
+		}
+		if err := stream.Send(&httpbody.HttpBody{ContentType: "application/octet-stream", Data: chunk}); err != nil {
+			return err
+		}
+		sent += int64(len(chunk))
+		if err := throttle(stream.Context(), start, sent, rate); err != nil {
+			return err
+		}
+	}
+
+	elapsed := time.Since(start)
+	achieved := throughput(sent, elapsed)
+	requestID := "-"
+	if values := requestHeader(stream.Context(), RequestIDHeader); len(values) > 0 {
+		requestID = values[0]
+	}
+	log.Printf("Streamed %d bytes in %s: %s/s (request ID %s)", sent, elapsed, formatBytes(achieved), requestID)
+	stream.SetTrailer(metadata.Pairs(
+		BytesTrailer, strconv.FormatInt(sent, 10),
+		ElapsedTrailer, elapsed.String(),
+		ThroughputTrailer, strconv.FormatInt(int64(achieved), 10),
+	))
+	return nil
+}
+
+// Payload returns request.Size random bytes in a single message, with the size of request.Data
+func (s *InfrabinService) Payload(ctx context.Context, request *PayloadRequest) (*PayloadResponse, error) {
+	if err := validateBytesSize(request.Size); err != nil {
+		return nil, err
+	}
+	data := make([]byte, request.Size)
+	if _, err := io.ReadFull(rand.Reader, data); err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to generate random data: %v", err)
+	}
+	hostname, err := os.Hostname()
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "cannot get hostname: %v", err)
+	}
+	return &PayloadResponse{
+		Hostname: hostname,
+		Received: int64(len(request.Data)),
+		Data:     data,
+	}, nil
+}
+
+// throttledChunkSize returns the default size of the chunks transferred at rate bytes per second:
+// BytesChunkSize, or less to transfer at least 10 chunks per second, so that low rates are smooth
+func throttledChunkSize(rate float64) int64 {
+	if rate <= 0 {
+		return BytesChunkSize
+	}
+	return max(1, min(BytesChunkSize, int64(rate/10)))
+}
+
+// throttle waits until the time n bytes take to transfer at rate bytes per second since start.
+// It returns immediately if rate is not positive, and an error if ctx is done first.
+func throttle(ctx context.Context, start time.Time, n int64, rate float64) error {
+	if rate <= 0 {
+		return nil
+	}
+	wait := time.Duration(float64(n)/rate*float64(time.Second)) - time.Since(start)
+	if wait <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return status.FromContextError(ctx.Err()).Err()
+	}
+}
+
+// validateBytesSize checks that n is between 0 and the maxBytesSize configuration
+func validateBytesSize(n int64) error {
+	if maxSize := viper.GetInt64("maxBytesSize"); n < 0 || n > maxSize {
+		return status.Errorf(codes.InvalidArgument, "the number of bytes must be between 0 and %d", maxSize)
+	}
+	return nil
+}
+
+// randomReader returns a reader of cryptographically secure random bytes,
+// or of deterministic random bytes generated from the seed if set
+func randomReader(seed *uint64) io.Reader {
+	if seed == nil {
+		return rand.Reader
+	}
+	var key [32]byte
+	binary.LittleEndian.PutUint64(key[:], *seed)
+	return mathrand.NewChaCha8(key)
+}
+
+// byteUnits are the units of parseByteRate, in lowercase
+var byteUnits = map[string]float64{
+	"":    1,
+	"b":   1,
+	"kb":  1e3,
+	"mb":  1e6,
+	"gb":  1e9,
+	"kib": 1 << 10,
+	"mib": 1 << 20,
+	"gib": 1 << 30,
+}
+
+// requestRate parses the rate of a request, returning 0 for an unlimited rate if empty
+func requestRate(value string) (float64, error) {
+	if value == "" {
+		return 0, nil
+	}
+	rate, err := parseByteRate(value)
+	if err != nil {
+		return 0, status.Errorf(codes.InvalidArgument, "invalid rate: %v", err)
+	}
+	return rate, nil
+}
+
+// parseByteRate parses a rate in bytes per second, e.g. "5MiB/s", "500KB/s" or "1024"
+func parseByteRate(value string) (float64, error) {
+	value = strings.TrimSuffix(strings.TrimSpace(value), "/s")
+	number := strings.TrimRightFunc(value, unicode.IsLetter)
+	unit, ok := byteUnits[strings.ToLower(strings.TrimSpace(value[len(number):]))]
+	if !ok {
+		return 0, fmt.Errorf("unknown unit in %q, must be B, KB, MB, GB, KiB, MiB or GiB", value)
+	}
+	rate, err := strconv.ParseFloat(strings.TrimSpace(number), 64)
+	if err != nil || rate <= 0 || math.IsInf(rate, 0) {
+		return 0, fmt.Errorf("%q is not a positive number", number)
+	}
+	return rate * unit, nil
+}
+
+// throughput returns the number of bytes per second of n bytes transferred in elapsed
+func throughput(n int64, elapsed time.Duration) float64 {
+	if elapsed <= 0 {
+		return 0
+	}
+	return float64(n) / elapsed.Seconds()
+}
+
+// formatBytes formats a number of bytes with binary units, e.g. "5.0MiB"
+func formatBytes(n float64) string {
+	units := []string{"B", "KiB", "MiB", "GiB"}
+	i := 0
+	for ; n >= 1024 && i < len(units)-1; i++ {
+		n /= 1024
+	}
+	return fmt.Sprintf("%.1f%s", n, units[i])
+}
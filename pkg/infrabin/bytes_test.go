@@ -0,0 +1,258 @@
+package infrabin
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+func TestBytesHandler(t *testing.T) {
+	viper.Set("maxBytesSize", MaxBytesSize)
+	defer viper.Reset()
+
+	get := func(path string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		handler := newHTTPInfrabinHandler()
+		handler.ServeHTTP(rr, httptest.NewRequest("GET", path, nil))
+		return rr
+	}
+
+	// Several chunks, the last one partial
+	n := 2*BytesChunkSize + 100
+	rr := get("/bytes/131172")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("handler returned wrong status code: got %v want %v: %s", rr.Code, http.StatusOK, rr.Body.String())
+	}
+	if got := rr.Header().Get("Content-Type"); got != "application/octet-stream" {
+		t.Errorf("Content-Type = %q, want application/octet-stream", got)
+	}
+	if rr.Body.Len() != n {
+		t.Errorf("body length = %d, want %d", rr.Body.Len(), n)
+	}
+	if bytes.Equal(rr.Body.Bytes(), get("/bytes/131172").Body.Bytes()) {
+		t.Errorf("expected different random bytes without seed")
+	}
+
+	seeded := get("/bytes/131172?seed=42").Body.Bytes()
+	if len(seeded) != n || !bytes.Equal(seeded, get("/bytes/131172?seed=42").Body.Bytes()) {
+		t.Errorf("expected the same %d bytes with the same seed", n)
+	}
+	if bytes.Equal(seeded, get("/bytes/131172?seed=43").Body.Bytes()) {
+		t.Errorf("expected different bytes with different seeds")
+	}
+}
+
+func TestBytesHandlerMaxSize(t *testing.T) {
+	viper.Set("maxBytesSize", 10)
+	defer viper.Set("maxBytesSize", MaxBytesSize)
+
+	for path, expected := range map[string]int{"/bytes/10": http.StatusOK, "/bytes/11": http.StatusBadRequest, "/bytes/-1": http.StatusBadRequest} {
+		rr := httptest.NewRecorder()
+		handler := newHTTPInfrabinHandler()
+		handler.ServeHTTP(rr, httptest.NewRequest("GET", path, nil))
+
+		if rr.Code != expected {
+			t.Errorf("%s returned wrong status code: got %v want %v", path, rr.Code, expected)
+		}
+	}
+}
+
+func TestBytesHandlerJSON(t *testing.T) {
+	raw := httptest.NewRecorder()
+	newHTTPInfrabinHandler().ServeHTTP(raw, httptest.NewRequest("GET", "/bytes/100?seed=42", nil))
+
+	for name, header := range map[string]string{
+		"/bytes/100?seed=42&format=json": "",
+		"/bytes/100?seed=42":             "application/json",
+		"/bytes/100?seed=42&charset":     "application/json; charset=utf-8",
+	} {
+		req := httptest.NewRequest("GET", name, nil)
+		if header != "" {
+			req.Header.Set("Accept", header)
+		}
+		rr := httptest.NewRecorder()
+		handler := newHTTPInfrabinHandler()
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusOK {
+			t.Fatalf("handler returned wrong status code: got %v want %v: %s", rr.Code, http.StatusOK, rr.Body.String())
+		}
+		var got Response
+		if err := protojson.Unmarshal(rr.Body.Bytes(), &got); err != nil {
+			t.Fatalf("failed to parse response %v: %v", rr.Body.String(), err)
+		}
+		if !bytes.Equal(got.RandomData.GetData(), raw.Body.Bytes()) {
+			t.Errorf("%s with Accept %q returned different bytes than the raw endpoint", name, header)
+		}
+	}
+
+	for _, path := range []string{"/bytes/abc?format=json", fmt.Sprintf("/bytes/%d?format=json", MaxRandomDataSize+1)} {
+		rr := httptest.NewRecorder()
+		newHTTPInfrabinHandler().ServeHTTP(rr, httptest.NewRequest("GET", path, nil))
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("%s returned wrong status code: got %v want %v", path, rr.Code, http.StatusBadRequest)
+		}
+	}
+}
+
+func TestPrefersJSON(t *testing.T) {
+	testCases := map[string]bool{
+		"":                                false,
+		"*/*":                             false,
+		"application/json":                true,
+		"application/json; charset=utf-8": true,
+		"application/octet-stream, application/json;q=0.5": false,
+		"application/json;q=0":                             false,
+	}
+	for accept, expected := range testCases {
+		if got := prefersJSON([]string{accept}); got != expected {
+			t.Errorf("prefersJSON(%q) = %v, want %v", accept, got, expected)
+		}
+	}
+}
+
+func TestRandomDataSeed(t *testing.T) {
+	viper.Set("maxBytesSize", 100)
+	defer viper.Set("maxBytesSize", MaxBytesSize)
+
+	service := &InfrabinService{}
+	seed := uint64(42)
+	first, err := service.RandomData(context.Background(), &RandomDataRequest{Path: 100, Seed: &seed})
+	if err != nil {
+		t.Fatalf("RandomData() error = %v", err)
+	}
+	second, err := service.RandomData(context.Background(), &RandomDataRequest{Path: 100, Seed: &seed})
+	if err != nil {
+		t.Fatalf("RandomData() error = %v", err)
+	}
+	if len(first.RandomData.Data) != 100 || !bytes.Equal(first.RandomData.Data, second.RandomData.Data) {
+		t.Errorf("expected the same 100 bytes with the same seed")
+	}
+
+	if _, err := service.RandomData(context.Background(), &RandomDataRequest{Path: 101}); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("RandomData() over the max size error = %v, want %v", err, codes.InvalidArgument)
+	}
+}
+
+func TestStreamBytesHandler(t *testing.T) {
+	viper.Set("maxBytesSize", MaxBytesSize)
+	defer viper.Reset()
+
+	// 10KiB at 40KiB/s takes 250ms
+	start := time.Now()
+	req := httptest.NewRequest("GET", "/stream-bytes/10240?rate=40KiB/s&chunk_size=1024&seed=1", nil)
+	rr := httptest.NewRecorder()
+	handler := newHTTPInfrabinHandler()
+	handler.ServeHTTP(rr, req)
+	elapsed := time.Since(start)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("handler returned wrong status code: got %v want %v: %s", rr.Code, http.StatusOK, rr.Body.String())
+	}
+	if rr.Body.Len() != 10240 {
+		t.Errorf("body length = %d, want 10240", rr.Body.Len())
+	}
+	if elapsed < 200*time.Millisecond || elapsed > 2*time.Second {
+		t.Errorf("stream took %v, want about 250ms", elapsed)
+	}
+
+	trailer := rr.Result().Trailer
+	if got := trailer.Get(BytesTrailer); got != "10240" {
+		t.Errorf("%s trailer = %q, want 10240", BytesTrailer, got)
+	}
+	if _, err := time.ParseDuration(trailer.Get(ElapsedTrailer)); err != nil {
+		t.Errorf("invalid %s trailer %q: %v", ElapsedTrailer, trailer.Get(ElapsedTrailer), err)
+	}
+	if throughput, err := strconv.Atoi(trailer.Get(ThroughputTrailer)); err != nil || throughput > 50<<10 {
+		t.Errorf("%s trailer = %q, want at most the target rate", ThroughputTrailer, trailer.Get(ThroughputTrailer))
+	}
+}
+
+func TestStreamBytesHandlerRequestID(t *testing.T) {
+	viper.Set("maxBytesSize", MaxBytesSize)
+	defer viper.Reset()
+
+	var logs bytes.Buffer
+	log.SetOutput(&logs)
+	defer log.SetOutput(os.Stderr)
+
+	req := httptest.NewRequest("GET", "/stream-bytes/1024", nil)
+	req.Header.Set(RequestIDHeader, "test-id")
+	rr := httptest.NewRecorder()
+	handler := newHTTPInfrabinHandler()
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("handler returned wrong status code: got %v want %v: %s", rr.Code, http.StatusOK, rr.Body.String())
+	}
+	if got := rr.Header().Get(RequestIDHeader); got != "test-id" {
+		t.Errorf("%s = %q, want %q", RequestIDHeader, got, "test-id")
+	}
+	if trailer := rr.Result().Trailer; trailer.Get(BytesTrailer) != "1024" {
+		t.Errorf("%s trailer = %q, want 1024", BytesTrailer, trailer.Get(BytesTrailer))
+	}
+	if !strings.Contains(logs.String(), "Streamed 1024 bytes") || !strings.Contains(logs.String(), "(request ID test-id)") {
+		t.Errorf("throughput not logged with the request ID: %q", logs.String())
+	}
+
+	// The request ID is generated when the request has none
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("GET", "/stream-bytes/1024", nil))
+	if id := rr.Header().Get(RequestIDHeader); id == "" || !strings.Contains(logs.String(), "(request ID "+id+")") {
+		t.Errorf("generated %s %q not logged: %q", RequestIDHeader, id, logs.String())
+	}
+}
+
+func TestStreamBytesHandlerInvalid(t *testing.T) {
+	viper.Set("maxBytesSize", MaxBytesSize)
+	defer viper.Reset()
+
+	for _, path := range []string{"/stream-bytes/10?rate=fast", "/stream-bytes/10?rate=-1", "/stream-bytes/10?chunk_size=2000000", "/stream-bytes/-1"} {
+		rr := httptest.NewRecorder()
+		handler := newHTTPInfrabinHandler()
+		handler.ServeHTTP(rr, httptest.NewRequest("GET", path, nil))
+
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("%s returned wrong status code: got %v want %v", path, rr.Code, http.StatusBadRequest)
+		}
+	}
+}
+
+func TestParseByteRate(t *testing.T) {
+	testCases := []struct {
+		value    string
+		expected float64
+	}{
+		{"1024", 1024},
+		{"100B", 100},
+		{"5MiB/s", 5 << 20},
+		{"500KB/s", 500e3},
+		{"1.5 kib", 1536},
+		{"2GB", 2e9},
+	}
+
+	for _, tc := range testCases {
+		got, err := parseByteRate(tc.value)
+		if err != nil || got != tc.expected {
+			t.Errorf("parseByteRate(%q) = %v, %v, want %v", tc.value, got, err, tc.expected)
+		}
+	}
+	for _, value := range []string{"", "fast", "0", "-1MiB", "5Mbps", "NaN"} {
+		if _, err := parseByteRate(value); err == nil {
+			t.Errorf("parseByteRate(%q) succeeded, want an error", value)
+		}
+	}
+}
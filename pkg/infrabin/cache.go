@@ -0,0 +1,154 @@
+package infrabin
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// ResponseIDHeader is the header of the ID generated for every response of the cache endpoints.
+// Unlike the id field of the body, it is also sent with the 304 and 412 responses.
+const ResponseIDHeader = "X-Response-Id"
+
+// Cache returns 304 Not Modified if the request has an If-Modified-Since or If-None-Match header,
+// whatever their values, otherwise a response with new Last-Modified and ETag headers.
+// The ETag is the generated ID of the response.
+func (s *InfrabinService) Cache(ctx context.Context, _ *Empty) (*Response, error) {
+	id := rand.Text()
+	response := &CacheResponse{
+		Id:           id,
+		Etag:         quoteETag(id),
+		LastModified: time.Now().UTC().Format(http.TimeFormat),
+	}
+	ifNoneMatch := requestHeader(ctx, "If-None-Match")
+	ifModifiedSince := requestHeader(ctx, "If-Modified-Since")
+	if len(ifNoneMatch) > 0 || len(ifModifiedSince) > 0 {
+		// The 304 response carries the validators of the stored response it refers to (RFC 9110 section 15.4.5),
+		// i.e. the ones of the request, or new ones when the request does not have them.
+		if len(ifNoneMatch) > 0 {
+			if etag, _, ok := scanETag(strings.TrimSpace(ifNoneMatch[0])); ok {
+				response.Etag = etag
+			}
+		}
+		if len(ifModifiedSince) > 0 {
+			if t, err := http.ParseTime(ifModifiedSince[0]); err == nil {
+				response.LastModified = t.UTC().Format(http.TimeFormat)
+			}
+		}
+		setHTTPCode(ctx, http.StatusNotModified)
+	}
+	return cacheResponse(ctx, response)
+}
+
+// CacheControl returns a response with a Cache-Control header allowing caches to store it for request.Seconds.
+func (s *InfrabinService) CacheControl(ctx context.Context, request *CacheControlRequest) (*Response, error) {
+	if request.Seconds < 0 {
+		return nil, status.Errorf(codes.InvalidArgument, "seconds must not be negative")
+	}
+	return cacheResponse(ctx, &CacheResponse{
+		Id:           rand.Text(),
+		CacheControl: fmt.Sprintf("public, max-age=%d", request.Seconds),
+	})
+}
+
+// ETag returns a response with the request.Etag ETag header.
+// It returns 412 Precondition Failed if the If-Match header does not match the ETag,
+// and 304 Not Modified if the If-None-Match header matches it, as defined by RFC 9110.
+func (s *InfrabinService) ETag(ctx context.Context, request *ETagRequest) (*Response, error) {
+	etag := quoteETag(request.Etag)
+	if _, rest, ok := scanETag(etag); request.Etag == "" || !ok || rest != "" {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid etag %q", request.Etag)
+	}
+
+	id := rand.Text()
+	if ifMatch := requestHeader(ctx, "If-Match"); len(ifMatch) > 0 && !matchETag(ifMatch, etag, false) {
+		if err := setHTTPHeaders(ctx, http.Header{ResponseIDHeader: {id}}); err != nil {
+			return nil, err
+		}
+		return nil, httpStatusError(ctx, http.StatusPreconditionFailed, "If-Match does not match the ETag %s", etag)
+	}
+	if ifNoneMatch := requestHeader(ctx, "If-None-Match"); len(ifNoneMatch) > 0 && matchETag(ifNoneMatch, etag, true) {
+		setHTTPCode(ctx, http.StatusNotModified)
+	}
+	return cacheResponse(ctx, &CacheResponse{Id: id, Etag: etag})
+}
+
+// cacheResponse sets the ID, validators and Cache-Control header of the response, and describes them
+func cacheResponse(ctx context.Context, response *CacheResponse) (*Response, error) {
+	header := http.Header{ResponseIDHeader: {response.Id}}
+	if response.Etag != "" {
+		header.Set("ETag", response.Etag)
+	}
+	if response.LastModified != "" {
+		header.Set("Last-Modified", response.LastModified)
+	}
+	if response.CacheControl != "" {
+		header.Set("Cache-Control", response.CacheControl)
+	}
+	if err := setHTTPHeaders(ctx, header); err != nil {
+		return nil, err
+	}
+
+	hostname, err := os.Hostname()
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "cannot get hostname: %v", err)
+	}
+	return &Response{Hostname: hostname, Cache: response}, nil
+}
+
+// quoteETag returns the entity tag as a strong ETag, e.g. `"abc"`
+func quoteETag(tag string) string {
+	return `"` + tag + `"`
+}
+
+// matchETag reports whether the If-Match or If-None-Match header values match the etag.
+// The weak comparison ignores the W/ prefix of the ETags, the strong comparison never matches weak ETags.
+func matchETag(values []string, etag string, weak bool) bool {
+	for _, value := range values {
+		for rest := strings.TrimSpace(value); rest != ""; rest = strings.TrimLeft(rest, " \t,") {
+			if rest[0] == '*' {
+				return true
+			}
+			tag, next, ok := scanETag(rest)
+			if !ok {
+				break
+			}
+			if weak {
+				tag = strings.TrimPrefix(tag, "W/")
+			}
+			if tag == etag {
+				return true
+			}
+			rest = next
+		}
+	}
+	return false
+}
+
+// scanETag returns the ETag at the start of s, e.g. `W/"abc"`, and the rest of s after it.
+// The characters of the entity tag must be visible ASCII or obs-text, except the double quote.
+func scanETag(s string) (etag string, rest string, ok bool) {
+	start := s
+	s = strings.TrimPrefix(s, "W/")
+	if len(s) < 2 || s[0] != '"' {
+		return "", "", false
+	}
+	for i := 1; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '"':
+			end := len(start) - len(s) + i + 1
+			return start[:end], start[end:], true
+		case c == 0x21 || c >= 0x23 && c <= 0x7e || c >= 0x80:
+		default:
+			return "", "", false
+		}
+	}
+	return "", "", false
+}
@@ -0,0 +1,164 @@
+package infrabin
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+func TestCacheHandler(t *testing.T) {
+	testCases := []struct {
+		name           string
+		header         string
+		value          string
+		expectedStatus int
+	}{
+		{name: "no validators", expectedStatus: http.StatusOK},
+		{name: "if-none-match", header: "If-None-Match", value: `"abc"`, expectedStatus: http.StatusNotModified},
+		{name: "if-modified-since", header: "If-Modified-Since", value: "Wed, 21 Oct 2015 07:28:00 GMT", expectedStatus: http.StatusNotModified},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/cache", nil)
+			if tc.header != "" {
+				req.Header.Set(tc.header, tc.value)
+			}
+			rr := httptest.NewRecorder()
+			handler := newHTTPInfrabinHandler()
+			handler.ServeHTTP(rr, req)
+
+			if rr.Code != tc.expectedStatus {
+				t.Fatalf("handler returned wrong status code: got %v want %v: %s", rr.Code, tc.expectedStatus, rr.Body.String())
+			}
+			if rr.Header().Get(ResponseIDHeader) == "" {
+				t.Errorf("%s header is missing", ResponseIDHeader)
+			}
+			if tc.expectedStatus != http.StatusOK {
+				if rr.Header().Get("ETag") == "" || rr.Header().Get("Last-Modified") == "" {
+					t.Errorf("304 response without validators: ETag %q, Last-Modified %q", rr.Header().Get("ETag"), rr.Header().Get("Last-Modified"))
+				}
+				if tc.header == "If-None-Match" && rr.Header().Get("ETag") != tc.value {
+					t.Errorf("ETag = %q, want %q", rr.Header().Get("ETag"), tc.value)
+				}
+				if tc.header == "If-Modified-Since" && rr.Header().Get("Last-Modified") != tc.value {
+					t.Errorf("Last-Modified = %q, want %q", rr.Header().Get("Last-Modified"), tc.value)
+				}
+				return
+			}
+			var got Response
+			if err := protojson.Unmarshal(rr.Body.Bytes(), &got); err != nil {
+				t.Fatalf("failed to parse response %v: %v", rr.Body.String(), err)
+			}
+			if got.Cache.GetId() == "" || rr.Header().Get(ResponseIDHeader) != got.Cache.GetId() {
+				t.Errorf("%s = %q, want the id %q", ResponseIDHeader, rr.Header().Get(ResponseIDHeader), got.Cache.GetId())
+			}
+			if rr.Header().Get("ETag") != quoteETag(got.Cache.GetId()) {
+				t.Errorf("ETag = %q, want the quoted id %q", rr.Header().Get("ETag"), got.Cache.GetId())
+			}
+			if _, err := http.ParseTime(rr.Header().Get("Last-Modified")); err != nil {
+				t.Errorf("invalid Last-Modified %q: %v", rr.Header().Get("Last-Modified"), err)
+			}
+		})
+	}
+}
+
+func TestCacheControlHandler(t *testing.T) {
+	ids := make(map[string]bool)
+	for range 2 {
+		rr := httptest.NewRecorder()
+		handler := newHTTPInfrabinHandler()
+		handler.ServeHTTP(rr, httptest.NewRequest("GET", "/cache/60", nil))
+
+		if rr.Code != http.StatusOK {
+			t.Fatalf("handler returned wrong status code: got %v want %v: %s", rr.Code, http.StatusOK, rr.Body.String())
+		}
+		if got, want := rr.Header().Get("Cache-Control"), "public, max-age=60"; got != want {
+			t.Errorf("Cache-Control = %q, want %q", got, want)
+		}
+		var got Response
+		if err := protojson.Unmarshal(rr.Body.Bytes(), &got); err != nil {
+			t.Fatalf("failed to parse response %v: %v", rr.Body.String(), err)
+		}
+		ids[got.Cache.GetId()] = true
+	}
+	if len(ids) != 2 {
+		t.Errorf("expected a new id for every response, got %v", ids)
+	}
+
+	rr := httptest.NewRecorder()
+	newHTTPInfrabinHandler().ServeHTTP(rr, httptest.NewRequest("GET", "/cache/-1", nil))
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusBadRequest)
+	}
+}
+
+func TestETagHandler(t *testing.T) {
+	testCases := []struct {
+		name           string
+		path           string
+		header         string
+		value          string
+		expectedStatus int
+	}{
+		{name: "no precondition", path: "/etag/abc", expectedStatus: http.StatusOK},
+		{name: "if-none-match", path: "/etag/abc", header: "If-None-Match", value: `"abc"`, expectedStatus: http.StatusNotModified},
+		{name: "if-none-match list", path: "/etag/abc", header: "If-None-Match", value: `"xyz", W/"abc"`, expectedStatus: http.StatusNotModified},
+		{name: "if-none-match star", path: "/etag/abc", header: "If-None-Match", value: "*", expectedStatus: http.StatusNotModified},
+		{name: "if-none-match mismatch", path: "/etag/abc", header: "If-None-Match", value: `"xyz"`, expectedStatus: http.StatusOK},
+		{name: "if-match", path: "/etag/abc", header: "If-Match", value: `"xyz", "abc"`, expectedStatus: http.StatusOK},
+		{name: "if-match star", path: "/etag/abc", header: "If-Match", value: "*", expectedStatus: http.StatusOK},
+		{name: "if-match mismatch", path: "/etag/abc", header: "If-Match", value: `"xyz"`, expectedStatus: http.StatusPreconditionFailed},
+		{name: "if-match weak", path: "/etag/abc", header: "If-Match", value: `W/"abc"`, expectedStatus: http.StatusPreconditionFailed},
+		{name: "invalid etag", path: "/etag/a%22b", expectedStatus: http.StatusBadRequest},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", tc.path, nil)
+			if tc.header != "" {
+				req.Header.Set(tc.header, tc.value)
+			}
+			rr := httptest.NewRecorder()
+			handler := newHTTPInfrabinHandler()
+			handler.ServeHTTP(rr, req)
+
+			if rr.Code != tc.expectedStatus {
+				t.Fatalf("handler returned wrong status code: got %v want %v: %s", rr.Code, tc.expectedStatus, rr.Body.String())
+			}
+			if tc.expectedStatus == http.StatusBadRequest {
+				return
+			}
+			if rr.Header().Get(ResponseIDHeader) == "" {
+				t.Errorf("%s header is missing", ResponseIDHeader)
+			}
+			if tc.expectedStatus == http.StatusPreconditionFailed {
+				return
+			}
+			if got := rr.Header().Get("ETag"); got != `"abc"` {
+				t.Errorf("ETag = %q, want %q", got, `"abc"`)
+			}
+		})
+	}
+}
+
+func TestETagGRPC(t *testing.T) {
+	service := &InfrabinService{}
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("if-match", `"xyz"`))
+	if _, err := service.ETag(ctx, &ETagRequest{Etag: "abc"}); err == nil {
+		t.Errorf("ETag() with a mismatching If-Match succeeded, want an error")
+	}
+
+	ctx = metadata.NewIncomingContext(context.Background(), metadata.Pairs("if-match", `"abc"`))
+	response, err := service.ETag(ctx, &ETagRequest{Etag: "abc"})
+	if err != nil {
+		t.Fatalf("ETag() error = %v", err)
+	}
+	if response.Cache.GetEtag() != `"abc"` || response.Cache.GetId() == "" {
+		t.Errorf("unexpected cache response: %v", response.Cache)
+	}
+}
@@ -0,0 +1,199 @@
+package infrabin
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+)
+
+// IP describes the client IP of the request and how it was found, from the same sources as Anything.
+func (s *InfrabinService) IP(ctx context.Context, request *Empty) (*Response, error) {
+	var peerAddress string
+	var get func(name string) []string
+	if r, ok := httpRequestFromContext(ctx); ok {
+		peerAddress = peerAddr(r)
+		get = r.Header.Values
+	} else {
+		md, _ := metadata.FromIncomingContext(ctx)
+		if p, ok := peer.FromContext(ctx); ok {
+			peerAddress = p.Addr.String()
+		}
+		get = md.Get
+	}
+
+	realIP := strings.Join(get("X-Real-IP"), ",")
+	return &Response{
+		Ip: &IPResponse{
+			Peer:          peerAddress,
+			XForwardedFor: splitHeaderValues(get("X-Forwarded-For")),
+			Forwarded:     get("Forwarded"),
+			XRealIp:       realIP,
+			ClientIp:      clientIP(peerAddress, forwardedChain(get), realIP, trustedProxiesFromContext(ctx)),
+		},
+	}, nil
+}
+
+// peerAddrKey is the context key of the address of the TCP peer
+type peerAddrKey struct{}
+
+// withPeerAddr stores the address of the TCP peer in the request context,
+// before handlers.ProxyHeaders rewrites RemoteAddr from the proxy headers.
+func withPeerAddr(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), peerAddrKey{}, r.RemoteAddr)))
+	})
+}
+
+// peerAddr returns the address of the TCP peer of the request, even if RemoteAddr was rewritten
+func peerAddr(r *http.Request) string {
+	if addr, ok := r.Context().Value(peerAddrKey{}).(string); ok {
+		return addr
+	}
+	return r.RemoteAddr
+}
+
+// getSourceIP returns the client IP of the request, trusting the proxy headers only from the trusted proxies
+func getSourceIP(r *http.Request) string {
+	return clientIP(peerAddr(r), forwardedChain(r.Header.Values), r.Header.Get("X-Real-IP"), trustedProxiesFromContext(r.Context()))
+}
+
+// ParseTrustedProxies parses a list of CIDRs or IP addresses.
+// The servers parse the trusted proxies once when they are created, so that invalid values fail early.
+func ParseTrustedProxies(values []string) ([]netip.Prefix, error) {
+	prefixes := make([]netip.Prefix, 0, len(values))
+	for _, value := range values {
+		value = strings.TrimSpace(value)
+		if value == "" {
+			continue
+		}
+		if prefix, err := netip.ParsePrefix(value); err == nil {
+			prefixes = append(prefixes, prefix.Masked())
+			continue
+		}
+		addr, err := netip.ParseAddr(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q: must be a CIDR or an IP address", value)
+		}
+		prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+	}
+	return prefixes, nil
+}
+
+// trustedProxiesKey is the context key of the trusted proxies
+type trustedProxiesKey struct{}
+
+// withTrustedProxies stores the trusted proxies in the request context,
+// so that they are parsed once by the server instead of for every request.
+func withTrustedProxies(trusted []netip.Prefix, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), trustedProxiesKey{}, trusted)))
+	})
+}
+
+// trustedProxiesUnaryServerInterceptor stores the trusted proxies in the context of the gRPC requests, like withTrustedProxies
+func trustedProxiesUnaryServerInterceptor(trusted []netip.Prefix) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		return handler(context.WithValue(ctx, trustedProxiesKey{}, trusted), req)
+	}
+}
+
+// trustedProxiesFromContext returns the trusted proxies stored in the context, if any
+func trustedProxiesFromContext(ctx context.Context) []netip.Prefix {
+	trusted, _ := ctx.Value(trustedProxiesKey{}).([]netip.Prefix)
+	return trusted
+}
+
+// forwardedChain returns the forwarding chain from the client to the last proxy,
+// from the X-Forwarded-For headers, or the for parameters of the Forwarded headers.
+func forwardedChain(get func(name string) []string) []string {
+	if chain := splitHeaderValues(get("X-Forwarded-For")); len(chain) > 0 {
+		return chain
+	}
+	var chain []string
+	for _, element := range splitHeaderValues(get("Forwarded")) {
+		for _, pair := range strings.Split(element, ";") {
+			key, value, ok := strings.Cut(strings.TrimSpace(pair), "=")
+			if ok && strings.EqualFold(key, "for") {
+				chain = append(chain, strings.Trim(value, `"`))
+			}
+		}
+	}
+	return chain
+}
+
+// clientIP walks the forwarding chain right-to-left, starting from the TCP peer, past the trusted proxies.
+// It returns the first untrusted hop, or the leftmost valid hop when all of them are trusted.
+// X-Real-IP is only used when it is set by a trusted peer without a forwarding chain.
+func clientIP(peerAddress string, chain []string, realIP string, trusted []netip.Prefix) string {
+	client, ok := parseHop(peerAddress)
+	if !ok {
+		// e.g. a Unix socket
+		return peerAddress
+	}
+	if !isTrustedProxy(client, trusted) {
+		return client.String()
+	}
+	if len(chain) == 0 {
+		if ip, ok := parseHop(realIP); ok {
+			return ip.String()
+		}
+		return client.String()
+	}
+
+	for i := len(chain) - 1; i >= 0; i-- {
+		ip, ok := parseHop(chain[i])
+		if !ok {
+			// The chain cannot be trusted past an invalid hop
+			break
+		}
+		client = ip
+		if !isTrustedProxy(ip, trusted) {
+			break
+		}
+	}
+	return client.String()
+}
+
+// isTrustedProxy returns true if the IP is in one of the trusted prefixes
+func isTrustedProxy(ip netip.Addr, trusted []netip.Prefix) bool {
+	for _, prefix := range trusted {
+		if prefix.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseHop parses a hop of a forwarding chain: an IP address, optionally with a port,
+// and with brackets for IPv6, e.g. 192.0.2.1, 192.0.2.1:80, [2001:db8::1]:80
+func parseHop(hop string) (netip.Addr, bool) {
+	hop = strings.TrimSpace(hop)
+	if host, _, err := net.SplitHostPort(hop); err == nil {
+		hop = host
+	}
+	ip, err := netip.ParseAddr(strings.Trim(hop, "[]"))
+	if err != nil {
+		return netip.Addr{}, false
+	}
+	return ip.Unmap(), true
+}
+
+// splitHeaderValues splits the comma separated values of a header
+func splitHeaderValues(values []string) []string {
+	var result []string
+	for _, value := range values {
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				result = append(result, item)
+			}
+		}
+	}
+	return result
+}
@@ -0,0 +1,190 @@
+package infrabin
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"reflect"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/spf13/viper"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/testing/protocmp"
+)
+
+func TestClientIP(t *testing.T) {
+	trusted, err := ParseTrustedProxies([]string{"10.0.0.0/8", "192.0.2.10"})
+	if err != nil {
+		t.Fatalf("ParseTrustedProxies() returned unexpected error: %v", err)
+	}
+
+	testCases := []struct {
+		name     string
+		peer     string
+		chain    []string
+		realIP   string
+		expected string
+	}{
+		{
+			name:     "untrusted peer ignores the headers",
+			peer:     "203.0.113.1:1234",
+			chain:    []string{"198.51.100.1"},
+			realIP:   "198.51.100.2",
+			expected: "203.0.113.1",
+		},
+		{
+			name:     "trusted peer uses the last untrusted hop",
+			peer:     "10.0.0.1:1234",
+			chain:    []string{"198.51.100.1", "203.0.113.1", "192.0.2.10"},
+			expected: "203.0.113.1",
+		},
+		{
+			name:     "all hops trusted returns the leftmost hop",
+			peer:     "10.0.0.1:1234",
+			chain:    []string{"10.0.0.3", "10.0.0.2"},
+			expected: "10.0.0.3",
+		},
+		{
+			name:     "invalid hop stops the walk",
+			peer:     "10.0.0.1:1234",
+			chain:    []string{"198.51.100.1", "unknown", "10.0.0.2"},
+			expected: "10.0.0.2",
+		},
+		{
+			name:     "hops with ports and brackets",
+			peer:     "[::ffff:10.0.0.1]:1234",
+			chain:    []string{"[2001:db8::1]:4711"},
+			expected: "2001:db8::1",
+		},
+		{
+			name:     "X-Real-IP from a trusted peer without chain",
+			peer:     "10.0.0.1:1234",
+			realIP:   "198.51.100.2",
+			expected: "198.51.100.2",
+		},
+		{
+			name:     "invalid peer is returned as is",
+			peer:     "@",
+			expected: "@",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := clientIP(tc.peer, tc.chain, tc.realIP, trusted); got != tc.expected {
+				t.Errorf("clientIP() = %v, want %v", got, tc.expected)
+			}
+		})
+	}
+}
+
+func TestParseTrustedProxies(t *testing.T) {
+	got, err := ParseTrustedProxies([]string{"10.1.2.3/8", "192.0.2.1", "2001:db8::/32", " "})
+	if err != nil {
+		t.Fatalf("ParseTrustedProxies() returned unexpected error: %v", err)
+	}
+	expected := []netip.Prefix{
+		netip.MustParsePrefix("10.0.0.0/8"),
+		netip.MustParsePrefix("192.0.2.1/32"),
+		netip.MustParsePrefix("2001:db8::/32"),
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("ParseTrustedProxies() = %v, want %v", got, expected)
+	}
+
+	if _, err := ParseTrustedProxies([]string{"10.0.0.0/33"}); err == nil {
+		t.Errorf("ParseTrustedProxies() expected error but got none")
+	}
+}
+
+func TestForwardedChain(t *testing.T) {
+	header := http.Header{}
+	header.Add("Forwarded", `for=192.0.2.60;proto=http;by=203.0.113.43, For="[2001:db8:cafe::17]:4711"`)
+	header.Add("Forwarded", "for=198.51.100.17")
+
+	expected := []string{"192.0.2.60", "[2001:db8:cafe::17]:4711", "198.51.100.17"}
+	if got := forwardedChain(header.Values); !reflect.DeepEqual(got, expected) {
+		t.Errorf("forwardedChain() = %v, want %v", got, expected)
+	}
+
+	header.Set("X-Forwarded-For", "198.51.100.1, 198.51.100.2")
+	expected = []string{"198.51.100.1", "198.51.100.2"}
+	if got := forwardedChain(header.Values); !reflect.DeepEqual(got, expected) {
+		t.Errorf("forwardedChain() = %v, want %v", got, expected)
+	}
+}
+
+func TestIPHandler(t *testing.T) {
+	trusted, err := ParseTrustedProxies([]string{"192.0.2.0/24"})
+	if err != nil {
+		t.Fatalf("ParseTrustedProxies() returned unexpected error: %v", err)
+	}
+
+	req := httptest.NewRequest("GET", "/ip", nil)
+	req.Header.Add("X-Forwarded-For", "203.0.113.1, 198.51.100.1")
+	req.Header.Add("X-Forwarded-For", "192.0.2.2")
+	req.Header.Set("X-Real-IP", "203.0.113.1")
+
+	rr := httptest.NewRecorder()
+	handler := withTrustedProxies(trusted, newHTTPInfrabinHandler())
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+	}
+	var got Response
+	if err := protojson.Unmarshal(rr.Body.Bytes(), &got); err != nil {
+		t.Fatalf("failed to parse response %v: %v", rr.Body.String(), err)
+	}
+	expected := &IPResponse{
+		Peer:          "192.0.2.1:1234",
+		XForwardedFor: []string{"203.0.113.1", "198.51.100.1", "192.0.2.2"},
+		XRealIp:       "203.0.113.1",
+		ClientIp:      "198.51.100.1",
+	}
+	if diff := cmp.Diff(expected, got.Ip, protocmp.Transform()); diff != "" {
+		t.Errorf("unexpected difference (-want +got):\n%s", diff)
+	}
+}
+
+func TestGetSourceIP(t *testing.T) {
+	trusted, err := ParseTrustedProxies([]string{"192.0.2.1"})
+	if err != nil {
+		t.Fatalf("ParseTrustedProxies() returned unexpected error: %v", err)
+	}
+
+	var got string
+	handler := withTrustedProxies(trusted, withPeerAddr(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Rewritten like handlers.ProxyHeaders does
+		r.RemoteAddr = "198.51.100.99"
+		got = getSourceIP(r)
+	})))
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("X-Forwarded-For", "198.51.100.99, 203.0.113.1")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	if got != "203.0.113.1" {
+		t.Errorf("getSourceIP() = %v, want %v", got, "203.0.113.1")
+	}
+}
+
+func TestNewHTTPServerTrustedProxies(t *testing.T) {
+	viper.Set("trustedProxies", []string{"192.0.2.0/24", "2001:db8::1"})
+	defer viper.Set("trustedProxies", []string{})
+
+	srv, err := NewHTTPServer("test")
+	if err != nil {
+		t.Fatalf("NewHTTPServer() returned unexpected error: %v", err)
+	}
+	expected := []netip.Prefix{netip.MustParsePrefix("192.0.2.0/24"), netip.MustParsePrefix("2001:db8::1/128")}
+	if !reflect.DeepEqual(srv.trustedProxies, expected) {
+		t.Errorf("trustedProxies = %v, want %v", srv.trustedProxies, expected)
+	}
+
+	viper.Set("trustedProxies", []string{"192.0.2.0/33"})
+	if _, err := NewHTTPServer("test"); err == nil {
+		t.Errorf("NewHTTPServer() expected error but got none")
+	}
+}
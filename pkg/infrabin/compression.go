@@ -0,0 +1,267 @@
+package infrabin
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+	"google.golang.org/genproto/googleapis/api/httpbody"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+// Content-Encoding values of the supported encodings
+const (
+	EncodingGzip    = "gzip"
+	EncodingDeflate = "deflate"
+	EncodingBrotli  = "br"
+	EncodingZstd    = "zstd"
+)
+
+// Headers reporting the sizes of compressed responses.
+// The dedicated endpoints send them as headers, the compression middleware as trailers,
+// since the sizes are only known once the whole body is written.
+const (
+	CompressedSizeHeader   = "X-Compressed-Size"
+	UncompressedSizeHeader = "X-Uncompressed-Size"
+)
+
+// compressionEncodings are the encodings supported by the compression middleware,
+// in order of preference when the client accepts several of them with the same weight
+var compressionEncodings = []string{EncodingZstd, EncodingBrotli, EncodingGzip, EncodingDeflate}
+
+// Gzip returns a gzip-encoded description of the response.
+func (s *InfrabinService) Gzip(ctx context.Context, _ *Empty) (*httpbody.HttpBody, error) {
+	return compressedResponse(ctx, EncodingGzip)
+}
+
+// Deflate returns a deflate-encoded description of the response.
+func (s *InfrabinService) Deflate(ctx context.Context, _ *Empty) (*httpbody.HttpBody, error) {
+	return compressedResponse(ctx, EncodingDeflate)
+}
+
+// Brotli returns a brotli-encoded description of the response.
+func (s *InfrabinService) Brotli(ctx context.Context, _ *Empty) (*httpbody.HttpBody, error) {
+	return compressedResponse(ctx, EncodingBrotli)
+}
+
+// compressedResponse returns the JSON description of the response, encoded with encoding,
+// and sets the Content-Encoding and size headers.
+func compressedResponse(ctx context.Context, encoding string) (*httpbody.HttpBody, error) {
+	hostname, err := os.Hostname()
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "cannot get hostname: %v", err)
+	}
+	var headers map[string]string
+	if r, ok := httpRequestFromContext(ctx); ok {
+		headers = joinValues(r.Header)
+	} else {
+		md, _ := metadata.FromIncomingContext(ctx)
+		headers = joinValues(md)
+	}
+	data, err := protojson.MarshalOptions{UseProtoNames: true}.Marshal(&Response{
+		Hostname:    hostname,
+		Compression: &CompressionResponse{Encoding: encoding, Headers: headers},
+	})
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "cannot marshal response: %v", err)
+	}
+
+	var buf bytes.Buffer
+	encoder, err := newEncoder(encoding, &buf)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "cannot create %s encoder: %v", encoding, err)
+	}
+	if _, err := encoder.Write(data); err != nil {
+		return nil, status.Errorf(codes.Internal, "cannot compress response: %v", err)
+	}
+	if err := encoder.Close(); err != nil {
+		return nil, status.Errorf(codes.Internal, "cannot compress response: %v", err)
+	}
+
+	if err := setHTTPHeaders(ctx, http.Header{
+		"Content-Encoding":     {encoding},
+		CompressedSizeHeader:   {strconv.Itoa(buf.Len())},
+		UncompressedSizeHeader: {strconv.Itoa(len(data))},
+	}); err != nil {
+		return nil, err
+	}
+	return &httpbody.HttpBody{ContentType: "application/json", Data: buf.Bytes()}, nil
+}
+
+// encoder is a compressing writer that can flush the data compressed so far
+type encoder interface {
+	io.WriteCloser
+	Flush() error
+}
+
+// newEncoder returns an encoder writing to w with the Content-Encoding encoding
+func newEncoder(encoding string, w io.Writer) (encoder, error) {
+	switch encoding {
+	case EncodingGzip:
+		return gzip.NewWriter(w), nil
+	case EncodingDeflate:
+		// The HTTP "deflate" encoding is the zlib format, not raw deflate
+		return zlib.NewWriter(w), nil
+	case EncodingBrotli:
+		return brotli.NewWriter(w), nil
+	case EncodingZstd:
+		return zstd.NewWriter(w, zstd.WithEncoderConcurrency(1))
+	default:
+		return nil, fmt.Errorf("unsupported encoding %q", encoding)
+	}
+}
+
+// negotiateEncoding returns the supported encoding with the highest weight in the Accept-Encoding header,
+// or an empty string if none is acceptable.
+func negotiateEncoding(acceptEncoding string) string {
+	weights := make(map[string]float64)
+	wildcard := 0.0
+	for _, item := range strings.Split(acceptEncoding, ",") {
+		name, params, _ := strings.Cut(item, ";")
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		weight := 1.0
+		if value, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			parsed, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				continue
+			}
+			weight = parsed
+		}
+		if name == "*" {
+			wildcard = weight
+		} else {
+			weights[name] = weight
+		}
+	}
+
+	var (
+		best       string
+		bestWeight float64
+	)
+	for _, encoding := range compressionEncodings {
+		weight, ok := weights[encoding]
+		if !ok {
+			weight = wildcard
+		}
+		if weight > bestWeight {
+			best, bestWeight = encoding, weight
+		}
+	}
+	return best
+}
+
+// CompressionMiddleware compresses the responses with the encoding negotiated from the Accept-Encoding header.
+// Responses that already have a Content-Encoding, e.g. from the /gzip endpoint, and partial responses
+// with a Content-Range, e.g. from the /range endpoint, are left as is.
+// The compressed and uncompressed sizes are sent as trailers.
+func CompressionMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Accept-Encoding")
+		encoding := negotiateEncoding(r.Header.Get("Accept-Encoding"))
+		if encoding == "" || r.Method == http.MethodHead {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		cw := &compressResponseWriter{ResponseWriter: w, encoding: encoding, compressed: &countingWriter{w: w}}
+		defer cw.close()
+		next.ServeHTTP(cw, r)
+	})
+}
+
+// compressResponseWriter compresses the body written to the wrapped http.ResponseWriter
+type compressResponseWriter struct {
+	http.ResponseWriter
+	encoding     string
+	encoder      encoder
+	compressed   *countingWriter
+	uncompressed int64
+	wroteHeader  bool
+}
+
+// WriteHeader starts compressing, unless the response is already encoded, partial or has no body
+func (cw *compressResponseWriter) WriteHeader(code int) {
+	if cw.wroteHeader || code < http.StatusOK {
+		cw.ResponseWriter.WriteHeader(code)
+		return
+	}
+	cw.wroteHeader = true
+
+	header := cw.Header()
+	if header.Get("Content-Encoding") == "" && header.Get("Content-Range") == "" &&
+		code != http.StatusNoContent && code != http.StatusNotModified {
+		if encoder, err := newEncoder(cw.encoding, cw.compressed); err == nil {
+			cw.encoder = encoder
+			header.Set("Content-Encoding", cw.encoding)
+			header.Del("Content-Length")
+			header.Del("Accept-Ranges")
+			header.Add("Trailer", CompressedSizeHeader)
+			header.Add("Trailer", UncompressedSizeHeader)
+		}
+	}
+	cw.ResponseWriter.WriteHeader(code)
+}
+
+func (cw *compressResponseWriter) Write(b []byte) (int, error) {
+	if !cw.wroteHeader {
+		cw.WriteHeader(http.StatusOK)
+	}
+	if cw.encoder == nil {
+		return cw.ResponseWriter.Write(b)
+	}
+	cw.uncompressed += int64(len(b))
+	return cw.encoder.Write(b)
+}
+
+// Flush writes the data compressed so far, so that streamed responses are not held by the encoder
+func (cw *compressResponseWriter) Flush() {
+	if !cw.wroteHeader {
+		cw.WriteHeader(http.StatusOK)
+	}
+	if cw.encoder != nil {
+		_ = cw.encoder.Flush()
+	}
+	_ = http.NewResponseController(cw.ResponseWriter).Flush()
+}
+
+// Unwrap returns the wrapped http.ResponseWriter, so that http.ResponseController can set deadlines
+func (cw *compressResponseWriter) Unwrap() http.ResponseWriter {
+	return cw.ResponseWriter
+}
+
+// close writes the end of the compressed body, and the size trailers
+func (cw *compressResponseWriter) close() {
+	if cw.encoder == nil {
+		return
+	}
+	_ = cw.encoder.Close()
+	cw.Header().Set(CompressedSizeHeader, strconv.FormatInt(cw.compressed.n, 10))
+	cw.Header().Set(UncompressedSizeHeader, strconv.FormatInt(cw.uncompressed, 10))
+}
+
+// countingWriter counts the bytes written to w
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(b []byte) (int, error) {
+	n, err := c.w.Write(b)
+	c.n += int64(n)
+	return n, err
+}
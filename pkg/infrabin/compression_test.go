@@ -0,0 +1,234 @@
+package infrabin
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+	"github.com/spf13/viper"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+// decompress decodes data with the Content-Encoding encoding
+func decompress(t *testing.T, encoding string, data []byte) []byte {
+	t.Helper()
+	var (
+		r   io.Reader
+		err error
+	)
+	switch encoding {
+	case EncodingGzip:
+		r, err = gzip.NewReader(bytes.NewReader(data))
+	case EncodingDeflate:
+		r, err = zlib.NewReader(bytes.NewReader(data))
+	case EncodingBrotli:
+		r = brotli.NewReader(bytes.NewReader(data))
+	case EncodingZstd:
+		var decoder *zstd.Decoder
+		decoder, err = zstd.NewReader(bytes.NewReader(data))
+		if err == nil {
+			defer decoder.Close()
+			r = decoder
+		}
+	default:
+		t.Fatalf("unexpected encoding %q", encoding)
+	}
+	if err != nil {
+		t.Fatalf("failed to create %s reader: %v", encoding, err)
+	}
+	decoded, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("failed to decode %s body: %v", encoding, err)
+	}
+	return decoded
+}
+
+func TestNegotiateEncoding(t *testing.T) {
+	testCases := []struct {
+		acceptEncoding string
+		expected       string
+	}{
+		{"", ""},
+		{"identity", ""},
+		{"gzip", EncodingGzip},
+		{"gzip, deflate, br, zstd", EncodingZstd},
+		{"gzip, deflate, br", EncodingBrotli},
+		{"deflate, gzip", EncodingGzip},
+		{"GZIP", EncodingGzip},
+		{"gzip;q=0.5, deflate", EncodingDeflate},
+		{"br;q=0, gzip;q=0.1", EncodingGzip},
+		{"*", EncodingZstd},
+		{"*, zstd;q=0", EncodingBrotli},
+		{"gzip;q=0", ""},
+		{"compress", ""},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.acceptEncoding, func(t *testing.T) {
+			if got := negotiateEncoding(tc.acceptEncoding); got != tc.expected {
+				t.Errorf("negotiateEncoding(%q) = %q, want %q", tc.acceptEncoding, got, tc.expected)
+			}
+		})
+	}
+}
+
+func TestCompressionMiddleware(t *testing.T) {
+	body := bytes.Repeat([]byte(`{"hostname": "infrabin"}`), 100)
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+		_, _ = w.Write(body[:10])
+		http.NewResponseController(w).Flush()
+		_, _ = w.Write(body[10:])
+	})
+	handler := CompressionMiddleware(next)
+
+	for _, encoding := range compressionEncodings {
+		t.Run(encoding, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/", nil)
+			req.Header.Set("Accept-Encoding", encoding)
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			result := rr.Result()
+			if got := result.Header.Get("Content-Encoding"); got != encoding {
+				t.Fatalf("Content-Encoding = %q, want %q", got, encoding)
+			}
+			if got := result.Header.Get("Content-Length"); got != "" {
+				t.Errorf("Content-Length = %q, want none", got)
+			}
+			if got := result.Header.Get("Vary"); got != "Accept-Encoding" {
+				t.Errorf("Vary = %q, want Accept-Encoding", got)
+			}
+			compressed, _ := io.ReadAll(result.Body)
+			if decoded := decompress(t, encoding, compressed); !bytes.Equal(decoded, body) {
+				t.Errorf("decoded body = %q, want %q", decoded, body)
+			}
+			if got := result.Trailer.Get(CompressedSizeHeader); got != strconv.Itoa(len(compressed)) {
+				t.Errorf("%s trailer = %q, want %d", CompressedSizeHeader, got, len(compressed))
+			}
+			if got := result.Trailer.Get(UncompressedSizeHeader); got != strconv.Itoa(len(body)) {
+				t.Errorf("%s trailer = %q, want %d", UncompressedSizeHeader, got, len(body))
+			}
+		})
+	}
+}
+
+func TestCompressionMiddlewarePassthrough(t *testing.T) {
+	testCases := []struct {
+		name            string
+		method          string
+		acceptEncoding  string
+		code            int
+		contentEncoding string
+		contentRange    string
+	}{
+		{name: "no accept encoding", method: "GET", code: http.StatusOK},
+		{name: "unsupported encoding", method: "GET", acceptEncoding: "compress", code: http.StatusOK},
+		{name: "head request", method: "HEAD", acceptEncoding: "gzip", code: http.StatusOK},
+		{name: "no content", method: "GET", acceptEncoding: "gzip", code: http.StatusNoContent},
+		{name: "already encoded", method: "GET", acceptEncoding: "gzip", code: http.StatusOK, contentEncoding: "br"},
+		{name: "partial content", method: "GET", acceptEncoding: "gzip", code: http.StatusPartialContent, contentRange: "bytes 0-2/10"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if tc.contentEncoding != "" {
+					w.Header().Set("Content-Encoding", tc.contentEncoding)
+				}
+				if tc.contentRange != "" {
+					w.Header().Set("Content-Range", tc.contentRange)
+				}
+				w.WriteHeader(tc.code)
+				_, _ = w.Write([]byte("raw"))
+			})
+			req := httptest.NewRequest(tc.method, "/", nil)
+			if tc.acceptEncoding != "" {
+				req.Header.Set("Accept-Encoding", tc.acceptEncoding)
+			}
+			rr := httptest.NewRecorder()
+			CompressionMiddleware(next).ServeHTTP(rr, req)
+
+			if got := rr.Header().Get("Content-Encoding"); got != tc.contentEncoding {
+				t.Errorf("Content-Encoding = %q, want %q", got, tc.contentEncoding)
+			}
+			if tc.code != http.StatusNoContent && rr.Body.String() != "raw" {
+				t.Errorf("body = %q, want the raw body", rr.Body.String())
+			}
+		})
+	}
+}
+
+func TestCompressionHandlers(t *testing.T) {
+	viper.Set("compression", true)
+	defer viper.Set("compression", EnableCompression)
+
+	for path, encoding := range map[string]string{"/gzip": EncodingGzip, "/deflate": EncodingDeflate, "/brotli": EncodingBrotli} {
+		t.Run(path, func(t *testing.T) {
+			// The middleware must not compress the response again
+			req := httptest.NewRequest("GET", path, nil)
+			req.Header.Set("Accept-Encoding", "zstd")
+			rr := httptest.NewRecorder()
+			handler := newHTTPInfrabinHandler()
+			handler.ServeHTTP(rr, req)
+
+			if rr.Code != http.StatusOK {
+				t.Fatalf("handler returned wrong status code: got %v want %v: %s", rr.Code, http.StatusOK, rr.Body.String())
+			}
+			if got := rr.Header().Get("Content-Encoding"); got != encoding {
+				t.Fatalf("Content-Encoding = %q, want %q", got, encoding)
+			}
+			if got := rr.Header().Get("Content-Type"); got != "application/json" {
+				t.Errorf("Content-Type = %q, want application/json", got)
+			}
+			if got := rr.Header().Get(CompressedSizeHeader); got != strconv.Itoa(rr.Body.Len()) {
+				t.Errorf("%s = %q, want %d", CompressedSizeHeader, got, rr.Body.Len())
+			}
+
+			decoded := decompress(t, encoding, rr.Body.Bytes())
+			if got := rr.Header().Get(UncompressedSizeHeader); got != strconv.Itoa(len(decoded)) {
+				t.Errorf("%s = %q, want %d", UncompressedSizeHeader, got, len(decoded))
+			}
+			var got Response
+			if err := protojson.Unmarshal(decoded, &got); err != nil {
+				t.Fatalf("failed to parse response %s: %v", decoded, err)
+			}
+			if got.Compression.GetEncoding() != encoding || got.Compression.GetHeaders()["Accept-Encoding"] != "zstd" {
+				t.Errorf("unexpected compression response: %v", got.Compression)
+			}
+		})
+	}
+}
+
+func TestCompressionGatewayResponses(t *testing.T) {
+	viper.Set("compression", true)
+	defer viper.Set("compression", EnableCompression)
+
+	req := httptest.NewRequest("GET", "/anything", nil)
+	req.Header.Set("Accept-Encoding", "gzip, br;q=0.5")
+	rr := httptest.NewRecorder()
+	handler := newHTTPInfrabinHandler()
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+	}
+	if got := rr.Header().Get("Content-Encoding"); got != EncodingGzip {
+		t.Fatalf("Content-Encoding = %q, want %q", got, EncodingGzip)
+	}
+	var got Response
+	if err := protojson.Unmarshal(decompress(t, EncodingGzip, rr.Body.Bytes()), &got); err != nil {
+		t.Fatalf("failed to parse response: %v", err)
+	}
+	if got.Anything.GetMethod() != "GET" {
+		t.Errorf("unexpected response: %v", got.Anything)
+	}
+}
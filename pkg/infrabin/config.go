@@ -2,6 +2,7 @@ package infrabin
 
 import (
 	"fmt"
+	"math"
 	"strings"
 	"time"
 
@@ -18,13 +19,20 @@ const (
 	DefaultHTTPServerPort uint = 8888
 	DefaultPrometheusPort uint = 8887
 	DrainTimeout               = 15 * time.Second
+	GRPCMaxRecvMsgSize         = 4 << 20
+	GRPCMaxSendMsgSize         = math.MaxInt32
 	EnableProxyEndpoint        = false
+	EnableCompression          = false
 	HTTPIdleTimeout            = 15 * time.Second
 	HTTPReadHeaderTimeout      = 15 * time.Second
 	HTTPReadTimeout            = 60 * time.Second
 	HTTPWriteTimeout           = MaxDelay + time.Second
 	MaxDelay                   = 120 * time.Second
+	MaxBytesSize               = 100 << 20
+	MaxBodySize                = 10 << 20
 	ProxyAllowRegexp           = ".*"
+	RedirectAllowRegexp        = ".*"
+	EgressTCPAllowRegexp       = "^$"
 	IntermittentErrors         = 2
 	// EgressTimeout is the default timeout for egress HTTP/HTTPS connectivity tests.
 	// Set to 3 seconds to balance between detecting connection issues quickly and
@@ -57,6 +65,8 @@ func ReadConfiguration() error {
 	// gRPC Defaults
 	viper.SetDefault("grpc.host", DefaultHost)
 	viper.SetDefault("grpc.port", DefaultGRPCPort)
+	viper.SetDefault("grpc.maxRecvMsgSize", GRPCMaxRecvMsgSize)
+	viper.SetDefault("grpc.maxSendMsgSize", GRPCMaxSendMsgSize)
 
 	// http server Defaults
 	viper.SetDefault("server.host", DefaultHost)
@@ -70,6 +80,12 @@ func ReadConfiguration() error {
 	viper.SetDefault("proxyEndpoint", EnableProxyEndpoint)
 	viper.SetDefault("proxyAllowRegexp", ProxyAllowRegexp)
 
+	// Targets allowed by the /redirect-to endpoint
+	viper.SetDefault("redirectAllowRegexp", RedirectAllowRegexp)
+
+	// Compression of the gateway responses
+	viper.SetDefault("compression", EnableCompression)
+
 	// Other Infrastructure Defaults
 	viper.SetDefault("awsMetadataEndpoint", AWSMetadataEndpoint)
 
@@ -79,12 +95,24 @@ func ReadConfiguration() error {
 	// Max delay duration for Delay endpoint
 	viper.SetDefault("maxDelay", MaxDelay)
 
+	// Max number of bytes generated by the random data endpoints
+	viper.SetDefault("maxBytesSize", MaxBytesSize)
+
+	// Max size of the raw request bodies buffered by the /anything endpoint
+	viper.SetDefault("maxBodySize", MaxBodySize)
+
 	// Consecutive errors for intermittent endpoint
 	viper.SetDefault("intermittentErrors", IntermittentErrors)
 
 	// Egress endpoint timeout
 	viper.SetDefault("egressTimeout", EgressTimeout)
 
+	// Targets the /egress/tcp endpoint can send a payload to, none by default
+	viper.SetDefault("egressTCPAllowRegexp", EgressTCPAllowRegexp)
+
+	// Proxies trusted to set the client IP in the proxy headers
+	viper.SetDefault("trustedProxies", []string{})
+
 	// http timeouts
 	viper.SetDefault("httpWriteTimeout", HTTPWriteTimeout)
 	viper.SetDefault("httpReadTimeout", HTTPReadTimeout)
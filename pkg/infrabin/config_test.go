@@ -18,6 +18,8 @@ func TestDefaultConfig(t *testing.T) {
 	}{
 		{"grpc.host", "0.0.0.0"},
 		{"grpc.port", "50051"},
+		{"grpc.maxRecvMsgSize", "4194304"},
+		{"grpc.maxSendMsgSize", "2147483647"},
 
 		{"server.host", "0.0.0.0"},
 		{"server.port", "8888"},
@@ -27,8 +29,12 @@ func TestDefaultConfig(t *testing.T) {
 
 		{"proxyEndpoint", "false"},
 		{"proxyAllowRegexp", ".*"},
+		{"redirectAllowRegexp", ".*"},
+		{"egressTCPAllowRegexp", "^$"},
 
 		{"awsMetadataEndpoint", "http://169.254.169.254/latest/meta-data/"},
+		{"maxBytesSize", "104857600"},
+		{"maxBodySize", "10485760"},
 	}
 
 	for _, tt := range tests {
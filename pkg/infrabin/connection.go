@@ -0,0 +1,153 @@
+package infrabin
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"path"
+	"strconv"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Connection faults misbehave below the HTTP status layer, e.g. to test how a proxy handles
+// "upstream connect error" or "reset before headers" cases that status codes cannot reproduce.
+const (
+	// ConnectionFaultReset closes the connection with a TCP RST before responding
+	ConnectionFaultReset = "reset"
+	// ConnectionFaultHang never responds, until the client closes the connection
+	ConnectionFaultHang = "hang"
+	// ConnectionFaultStall sends the headers and half of the body, then stalls until the client closes the connection
+	ConnectionFaultStall = "stall"
+	// ConnectionFaultTruncate sends the headers and half of the body, then closes the connection
+	ConnectionFaultTruncate = "truncate"
+)
+
+// DefaultConnectionFaultSize is the default Content-Length announced by the stall and truncate faults
+const DefaultConnectionFaultSize = 1024
+
+// MaxConnectionFaultSize is the maximum Content-Length announced by the stall and truncate faults
+const MaxConnectionFaultSize = 100 * 1024 * 1024
+
+// RegisterConnectionFaults registers the connection fault handlers under prefix, e.g. /connection/reset.
+// The handlers hijack the connection, so they are registered outside the gateway mux,
+// and fault injection and failure toggles do not apply to them.
+func RegisterConnectionFaults(prefix string) HTTPServerOption {
+	return func(ctx context.Context, s *HTTPServer) error {
+		serveMux, ok := s.Server.Handler.(*http.ServeMux)
+		if !ok {
+			return fmt.Errorf("handler is not *http.ServeMux")
+		}
+		serveMux.HandleFunc(path.Join(prefix, ConnectionFaultReset), resetConnectionHandler)
+		serveMux.HandleFunc(path.Join(prefix, ConnectionFaultHang), hangConnectionHandler)
+		serveMux.HandleFunc(path.Join(prefix, ConnectionFaultStall), stallConnectionHandler)
+		serveMux.HandleFunc(path.Join(prefix, ConnectionFaultTruncate), truncateConnectionHandler)
+		return nil
+	}
+}
+
+// resetConnectionHandler closes the connection with a TCP RST instead of a FIN
+func resetConnectionHandler(w http.ResponseWriter, r *http.Request) {
+	conn, _, ok := hijackConnection(w)
+	if !ok {
+		return
+	}
+	// A zero linger discards the unsent data and sends a RST on close
+	if tcpConn, ok := conn.(interface{ SetLinger(sec int) error }); ok {
+		_ = tcpConn.SetLinger(0)
+	}
+	_ = conn.Close()
+}
+
+// hangConnectionHandler accepts the request and never responds
+func hangConnectionHandler(w http.ResponseWriter, r *http.Request) {
+	conn, rw, ok := hijackConnection(w)
+	if !ok {
+		return
+	}
+	defer conn.Close()
+	waitForClientClose(rw)
+}
+
+// stallConnectionHandler sends the headers and half of the body, then stalls
+func stallConnectionHandler(w http.ResponseWriter, r *http.Request) {
+	size, ok := connectionFaultSize(w, r)
+	if !ok {
+		return
+	}
+	conn, rw, ok := hijackConnection(w)
+	if !ok {
+		return
+	}
+	defer conn.Close()
+	if err := writePartialResponse(rw, size); err != nil {
+		return
+	}
+	waitForClientClose(rw)
+}
+
+// truncateConnectionHandler sends the headers and half of the body, then closes the connection
+func truncateConnectionHandler(w http.ResponseWriter, r *http.Request) {
+	size, ok := connectionFaultSize(w, r)
+	if !ok {
+		return
+	}
+	conn, rw, ok := hijackConnection(w)
+	if !ok {
+		return
+	}
+	defer conn.Close()
+	_ = writePartialResponse(rw, size)
+}
+
+// connectionFaultSize returns the Content-Length from the size query parameter,
+// or writes a Bad Request error if it is invalid
+func connectionFaultSize(w http.ResponseWriter, r *http.Request) (int, bool) {
+	value := r.URL.Query().Get("size")
+	if value == "" {
+		return DefaultConnectionFaultSize, true
+	}
+	size, err := strconv.Atoi(value)
+	if err != nil || size < 2 || size > MaxConnectionFaultSize {
+		writeStatusError(w, http.StatusBadRequest, status.Errorf(codes.InvalidArgument, "size must be a number between 2 and %d", MaxConnectionFaultSize))
+		return 0, false
+	}
+	return size, true
+}
+
+// hijackConnection takes over the connection of the response, clearing the deadlines set by the server.
+// Writes an Internal Server Error if the connection cannot be hijacked, e.g. with HTTP/2.
+func hijackConnection(w http.ResponseWriter) (net.Conn, *bufio.ReadWriter, bool) {
+	conn, rw, err := http.NewResponseController(w).Hijack()
+	if err != nil {
+		writeStatusError(w, http.StatusInternalServerError, status.Errorf(codes.Internal, "unable to hijack connection: %v", err))
+		return nil, nil, false
+	}
+	_ = conn.SetDeadline(time.Time{})
+	return conn, rw, true
+}
+
+// writePartialResponse writes a response announcing size bytes, but only writes half of them
+func writePartialResponse(rw *bufio.ReadWriter, size int) error {
+	if _, err := fmt.Fprintf(rw, "HTTP/1.1 200 OK\r\nContent-Type: application/octet-stream\r\nContent-Length: %d\r\n\r\n", size); err != nil {
+		return err
+	}
+	chunk := bytes.Repeat([]byte("x"), 1024)
+	for remaining := size / 2; remaining > 0; remaining -= len(chunk) {
+		if _, err := rw.Write(chunk[:min(remaining, len(chunk))]); err != nil {
+			return err
+		}
+	}
+	return rw.Flush()
+}
+
+// waitForClientClose discards the data sent by the client until it closes the connection
+func waitForClientClose(rw *bufio.ReadWriter) {
+	_, _ = io.Copy(io.Discard, rw)
+}
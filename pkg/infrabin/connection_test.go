@@ -0,0 +1,112 @@
+package infrabin
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func newConnectionFaultsServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	srv, err := NewHTTPServer("test-connection", RegisterConnectionFaults("/connection/"))
+	if err != nil {
+		t.Fatalf("Failed to create HTTP server: %v", err)
+	}
+	server := httptest.NewServer(srv.Server.Handler)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestResetConnectionHandler(t *testing.T) {
+	server := newConnectionFaultsServer(t)
+
+	resp, err := http.Get(server.URL + "/connection/reset")
+	if err == nil {
+		resp.Body.Close()
+		t.Fatalf("GET /connection/reset expected error but got status %v", resp.StatusCode)
+	}
+}
+
+func TestHangConnectionHandler(t *testing.T) {
+	server := newConnectionFaultsServer(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, "GET", server.URL+"/connection/hang", nil)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err == nil {
+		resp.Body.Close()
+		t.Fatalf("GET /connection/hang expected error but got status %v", resp.StatusCode)
+	}
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("GET /connection/hang error = %v, want %v", err, context.DeadlineExceeded)
+	}
+}
+
+func TestStallConnectionHandler(t *testing.T) {
+	server := newConnectionFaultsServer(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, "GET", server.URL+"/connection/stall?size=10", nil)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("GET /connection/stall returned unexpected error: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("handler returned wrong status code: got %v want %v", resp.StatusCode, http.StatusOK)
+	}
+	if resp.ContentLength != 10 {
+		t.Errorf("handler returned wrong Content-Length: got %v want 10", resp.ContentLength)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("reading body error = %v, want %v", err, context.DeadlineExceeded)
+	}
+	if len(body) != 5 {
+		t.Errorf("handler returned %d bytes before stalling, want 5", len(body))
+	}
+}
+
+func TestTruncateConnectionHandler(t *testing.T) {
+	server := newConnectionFaultsServer(t)
+
+	resp, err := http.Get(server.URL + "/connection/truncate")
+	if err != nil {
+		t.Fatalf("GET /connection/truncate returned unexpected error: %v", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("reading body error = %v, want %v", err, io.ErrUnexpectedEOF)
+	}
+	if len(body) != DefaultConnectionFaultSize/2 {
+		t.Errorf("handler returned %d bytes, want %d", len(body), DefaultConnectionFaultSize/2)
+	}
+}
+
+func TestConnectionFaultInvalidSize(t *testing.T) {
+	srv, err := NewHTTPServer("test-connection", RegisterConnectionFaults("/connection/"))
+	if err != nil {
+		t.Fatalf("Failed to create HTTP server: %v", err)
+	}
+
+	for _, path := range []string{"/connection/stall?size=abc", "/connection/truncate?size=1"} {
+		req := httptest.NewRequest("GET", path, nil)
+		rr := httptest.NewRecorder()
+		srv.Server.Handler.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("GET %s returned wrong status code: got %v want %v", path, rr.Code, http.StatusBadRequest)
+		}
+	}
+}
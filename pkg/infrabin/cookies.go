@@ -0,0 +1,144 @@
+package infrabin
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// Cookies returns the cookies received.
+func (s *InfrabinService) Cookies(ctx context.Context, _ *Empty) (*Response, error) {
+	return cookiesResponse(ctx, nil)
+}
+
+// SetCookies sets the requested cookies, and returns the cookies received.
+func (s *InfrabinService) SetCookies(ctx context.Context, request *CookiesRequest) (*Response, error) {
+	var cookies []*http.Cookie
+	for name, value := range requestedCookies(ctx, request) {
+		cookie, err := newCookie(request, name, value)
+		if err != nil {
+			return nil, err
+		}
+		cookie.MaxAge = int(request.MaxAge)
+		cookies = append(cookies, cookie)
+	}
+	return cookiesResponse(ctx, cookies)
+}
+
+// DeleteCookies expires the requested cookies, and returns the cookies received.
+// The Domain and Path attributes must match the ones of the cookies to delete.
+func (s *InfrabinService) DeleteCookies(ctx context.Context, request *CookiesRequest) (*Response, error) {
+	var cookies []*http.Cookie
+	for name := range requestedCookies(ctx, request) {
+		cookie, err := newCookie(request, name, "")
+		if err != nil {
+			return nil, err
+		}
+		// A negative MaxAge sends "Max-Age=0", which deletes the cookie
+		cookie.MaxAge = -1
+		cookies = append(cookies, cookie)
+	}
+	return cookiesResponse(ctx, cookies)
+}
+
+// requestedCookies returns the names and values of the cookies to set or delete.
+// Requests from the gateway use the query parameters other than the fields of CookiesRequest,
+// so that any cookie name can be set.
+func requestedCookies(ctx context.Context, request *CookiesRequest) map[string]string {
+	r, ok := httpRequestFromContext(ctx)
+	if !ok {
+		return request.Cookies
+	}
+	attributes := request.ProtoReflect().Descriptor().Fields()
+	cookies := make(map[string]string)
+	for name, values := range r.URL.Query() {
+		if attributes.ByName(protoreflect.Name(name)) != nil || attributes.ByJSONName(name) != nil {
+			continue
+		}
+		cookies[name] = values[0]
+	}
+	return cookies
+}
+
+// newCookie returns a cookie with the attributes of the request
+func newCookie(request *CookiesRequest, name string, value string) (*http.Cookie, error) {
+	cookie := &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Domain:   request.Domain,
+		Path:     request.Path,
+		Secure:   request.Secure,
+		HttpOnly: request.HttpOnly,
+	}
+	switch strings.ToLower(request.SameSite) {
+	case "":
+	case "lax":
+		cookie.SameSite = http.SameSiteLaxMode
+	case "strict":
+		cookie.SameSite = http.SameSiteStrictMode
+	case "none":
+		cookie.SameSite = http.SameSiteNoneMode
+	default:
+		return nil, status.Errorf(codes.InvalidArgument, "same_site must be one of Lax, Strict or None")
+	}
+	if err := cookie.Valid(); err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid cookie %q: %v", name, err)
+	}
+	return cookie, nil
+}
+
+// cookiesResponse sets the cookies on the response, and describes them with the cookies received.
+func cookiesResponse(ctx context.Context, cookies []*http.Cookie) (*Response, error) {
+	// Sort the cookies for a stable order of the Set-Cookie headers
+	slices.SortFunc(cookies, func(a, b *http.Cookie) int { return strings.Compare(a.Name, b.Name) })
+	header := http.Header{}
+	for _, cookie := range cookies {
+		header.Add("Set-Cookie", cookie.String())
+	}
+	if err := setHTTPHeaders(ctx, header); err != nil {
+		return nil, err
+	}
+
+	hostname, err := os.Hostname()
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "cannot get hostname: %v", err)
+	}
+	return &Response{
+		Hostname: hostname,
+		Cookies: &CookiesResponse{
+			Cookies:    receivedCookies(ctx),
+			SetCookies: header.Values("Set-Cookie"),
+		},
+	}, nil
+}
+
+// receivedCookies returns the cookies of the request, from the HTTP request or the gRPC metadata.
+// The values of cookies with the same name, e.g. with different paths, are joined with commas.
+func receivedCookies(ctx context.Context) map[string]string {
+	var cookies []*http.Cookie
+	if r, ok := httpRequestFromContext(ctx); ok {
+		cookies = r.Cookies()
+	} else {
+		md, _ := metadata.FromIncomingContext(ctx)
+		for _, line := range md.Get("cookie") {
+			parsed, err := http.ParseCookie(line)
+			if err != nil {
+				continue
+			}
+			cookies = append(cookies, parsed...)
+		}
+	}
+
+	values := make(map[string][]string)
+	for _, cookie := range cookies {
+		values[cookie.Name] = append(values[cookie.Name], cookie.Value)
+	}
+	return joinValues(values)
+}
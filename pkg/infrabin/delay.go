@@ -0,0 +1,109 @@
+package infrabin
+
+import (
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"strconv"
+	"time"
+)
+
+// Delay distributions supported by the Delay endpoint
+const (
+	DelayDistributionFixed     = "fixed"
+	DelayDistributionUniform   = "uniform"
+	DelayDistributionNormal    = "normal"
+	DelayDistributionLogNormal = "lognormal"
+	DelayDistributionPareto    = "pareto"
+)
+
+// parseDelayDuration parses a Go duration (e.g. "150ms") or a number of seconds (e.g. "1.5").
+// Negative durations are invalid.
+func parseDelayDuration(value string) (time.Duration, error) {
+	if seconds, err := strconv.ParseFloat(value, 64); err == nil {
+		if seconds < 0 || math.IsNaN(seconds) || math.IsInf(seconds, 0) {
+			return 0, fmt.Errorf("%q must be a positive number of seconds", value)
+		}
+		return durationFromFloat(seconds * float64(time.Second)), nil
+	}
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("%q is not a duration or a number of seconds", value)
+	}
+	if duration < 0 {
+		return 0, fmt.Errorf("%q must not be negative", value)
+	}
+	return duration, nil
+}
+
+// sampleDelay returns the delay requested, sampled from the requested distribution.
+// The result is never negative but is not capped by maxDelay.
+func sampleDelay(request *DelayRequest) (time.Duration, error) {
+	if request.Delay == "" {
+		if request.Seconds < 0 {
+			return 0, fmt.Errorf("seconds must not be negative")
+		}
+		return time.Duration(request.Seconds) * time.Second, nil
+	}
+
+	duration, err := parseDelayDuration(request.Delay)
+	if err != nil {
+		return 0, err
+	}
+
+	switch request.Distribution {
+	case "", DelayDistributionFixed:
+		return duration, nil
+
+	case DelayDistributionUniform:
+		maxDuration, err := parseDelayDuration(request.Max)
+		if err != nil {
+			return 0, fmt.Errorf("invalid max: %w", err)
+		}
+		if maxDuration < duration {
+			return 0, fmt.Errorf("max %s must not be lower than delay %s", maxDuration, duration)
+		}
+		if maxDuration == duration {
+			return duration, nil
+		}
+		return duration + time.Duration(rand.Int64N(int64(maxDuration-duration))), nil
+
+	case DelayDistributionNormal:
+		stddev := duration / 10
+		if request.Stddev != "" {
+			if stddev, err = parseDelayDuration(request.Stddev); err != nil {
+				return 0, fmt.Errorf("invalid stddev: %w", err)
+			}
+		}
+		return durationFromFloat(float64(duration) + rand.NormFloat64()*float64(stddev)), nil
+
+	case DelayDistributionLogNormal:
+		if request.Shape <= 0 {
+			return 0, fmt.Errorf("shape (sigma) must be greater than zero")
+		}
+		return durationFromFloat(float64(duration) * math.Exp(request.Shape*rand.NormFloat64())), nil
+
+	case DelayDistributionPareto:
+		if request.Shape <= 0 {
+			return 0, fmt.Errorf("shape (alpha) must be greater than zero")
+		}
+		// 1 - Float64() is in (0, 1], so the division is always defined
+		return durationFromFloat(float64(duration) / math.Pow(1-rand.Float64(), 1/request.Shape)), nil
+
+	default:
+		return 0, fmt.Errorf("unknown distribution %q", request.Distribution)
+	}
+}
+
+// durationFromFloat converts nanoseconds to a time.Duration, clamped between zero and the maximum duration.
+// The long tail of the lognormal and pareto distributions would otherwise overflow time.Duration.
+func durationFromFloat(nanoseconds float64) time.Duration {
+	switch {
+	case nanoseconds <= 0:
+		return 0
+	case nanoseconds >= math.MaxInt64:
+		return math.MaxInt64
+	default:
+		return time.Duration(nanoseconds)
+	}
+}
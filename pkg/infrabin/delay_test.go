@@ -0,0 +1,156 @@
+package infrabin
+
+import (
+	"testing"
+	"time"
+
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+func TestParseDelayDuration(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		want    time.Duration
+		wantErr bool
+	}{
+		{name: "whole seconds", value: "2", want: 2 * time.Second},
+		{name: "fractional seconds", value: "1.5", want: 1500 * time.Millisecond},
+		{name: "go duration", value: "150ms", want: 150 * time.Millisecond},
+		{name: "composite go duration", value: "1m30s", want: 90 * time.Second},
+		{name: "negative seconds", value: "-1", wantErr: true},
+		{name: "negative go duration", value: "-1s", wantErr: true},
+		{name: "not a number", value: "NaN", wantErr: true},
+		{name: "invalid", value: "abc", wantErr: true},
+		{name: "empty", value: "", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			got, err := parseDelayDuration(tt.value)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("parseDelayDuration(%q) expected error but got none", tt.value)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseDelayDuration(%q) returned unexpected error: %v", tt.value, err)
+			}
+			if got != tt.want {
+				t.Errorf("parseDelayDuration(%q) = %v, want %v", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSampleDelay(t *testing.T) {
+	tests := []struct {
+		name    string
+		request *DelayRequest
+		min     time.Duration
+		max     time.Duration
+		wantErr bool
+	}{
+		{
+			name:    "legacy seconds",
+			request: &DelayRequest{Seconds: 2},
+			min:     2 * time.Second,
+			max:     2 * time.Second,
+		},
+		{
+			name:    "fixed",
+			request: &DelayRequest{Delay: "150ms", Distribution: DelayDistributionFixed},
+			min:     150 * time.Millisecond,
+			max:     150 * time.Millisecond,
+		},
+		{
+			name:    "uniform",
+			request: &DelayRequest{Delay: "100ms", Distribution: DelayDistributionUniform, Max: "200ms"},
+			min:     100 * time.Millisecond,
+			max:     200 * time.Millisecond,
+		},
+		{
+			name:    "uniform with equal bounds",
+			request: &DelayRequest{Delay: "1s", Distribution: DelayDistributionUniform, Max: "1s"},
+			min:     time.Second,
+			max:     time.Second,
+		},
+		{
+			name:    "normal is never negative",
+			request: &DelayRequest{Delay: "0s", Distribution: DelayDistributionNormal, Stddev: "1s"},
+			min:     0,
+			max:     time.Hour,
+		},
+		{
+			name:    "lognormal",
+			request: &DelayRequest{Delay: "150ms", Distribution: DelayDistributionLogNormal, Shape: 1.1},
+			min:     0,
+			max:     time.Duration(1<<63 - 1),
+		},
+		{
+			name:    "pareto is never below the scale",
+			request: &DelayRequest{Delay: "150ms", Distribution: DelayDistributionPareto, Shape: 1.5},
+			min:     150 * time.Millisecond,
+			max:     time.Duration(1<<63 - 1),
+		},
+		{
+			name:    "uniform max lower than duration",
+			request: &DelayRequest{Delay: "2s", Distribution: DelayDistributionUniform, Max: "1s"},
+			wantErr: true,
+		},
+		{
+			name:    "normal without stddev",
+			request: &DelayRequest{Delay: "1s", Distribution: DelayDistributionNormal},
+			min:     0,
+			max:     2 * time.Second,
+		},
+		{
+			name:    "pareto without shape",
+			request: &DelayRequest{Delay: "1s", Distribution: DelayDistributionPareto},
+			wantErr: true,
+		},
+		{
+			name:    "unknown distribution",
+			request: &DelayRequest{Delay: "1s", Distribution: "poisson"},
+			wantErr: true,
+		},
+		{
+			name:    "negative seconds",
+			request: &DelayRequest{Seconds: -1},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			for range 100 {
+				got, err := sampleDelay(tt.request)
+				if tt.wantErr {
+					if err == nil {
+						t.Fatalf("sampleDelay() expected error but got none")
+					}
+					return
+				}
+				if err != nil {
+					t.Fatalf("sampleDelay() returned unexpected error: %v", err)
+				}
+				if got < tt.min || got > tt.max {
+					t.Fatalf("sampleDelay() = %v, want between %v and %v", got, tt.min, tt.max)
+				}
+			}
+		})
+	}
+}
+
+func TestDelayRequestJSON(t *testing.T) {
+	var request DelayRequest
+	if err := protojson.Unmarshal([]byte(`{"duration": 5, "delay": "150ms"}`), &request); err != nil {
+		t.Fatalf("protojson.Unmarshal() error = %v", err)
+	}
+	if request.Seconds != 5 || request.Delay != "150ms" {
+		t.Errorf("DelayRequest = %v, want seconds 5 and delay 150ms", &request)
+	}
+}
@@ -0,0 +1,187 @@
+package infrabin
+
+import (
+	"context"
+	"net/http"
+	"path"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"google.golang.org/genproto/googleapis/api/annotations"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+// FailureChecker is implemented by services whose RPCs can be configured to fail at runtime.
+type FailureChecker interface {
+	IsFailing(rpc string) bool
+}
+
+// FailureToggles stores the RPCs configured to fail at runtime.
+// The zero value is ready to use.
+type FailureToggles struct {
+	mu sync.Mutex
+	// failures maps the failing RPC names to their expiry time, the zero time meaning no expiry
+	failures map[string]time.Time
+}
+
+// Set makes the RPC fail, or restores it. A positive ttl reverts the failure once elapsed.
+func (f *FailureToggles) Set(rpc string, fail bool, ttl time.Duration) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if !fail {
+		delete(f.failures, rpc)
+		return
+	}
+	if f.failures == nil {
+		f.failures = make(map[string]time.Time)
+	}
+	var expiry time.Time
+	if ttl > 0 {
+		expiry = time.Now().Add(ttl)
+	}
+	f.failures[rpc] = expiry
+}
+
+// IsFailing returns true if the RPC is configured to fail and its ttl has not elapsed.
+func (f *FailureToggles) IsFailing(rpc string) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	expiry, ok := f.failures[rpc]
+	if !ok {
+		return false
+	}
+	if !expiry.IsZero() && time.Now().After(expiry) {
+		delete(f.failures, rpc)
+		return false
+	}
+	return true
+}
+
+// failureError returns the error returned by an RPC configured to fail
+func failureError(rpc string) error {
+	return status.Errorf(codes.Unavailable, "%s is configured to fail via SetFailure", rpc)
+}
+
+// infrabinMethodName returns the name of the Infrabin RPC matching name, case insensitive.
+func infrabinMethodName(name string) (string, bool) {
+	methods := File_infrabin_infrabin_proto.Services().ByName("Infrabin").Methods()
+	for i := 0; i < methods.Len(); i++ {
+		if methodName := string(methods.Get(i).Name()); strings.EqualFold(methodName, name) {
+			return methodName, true
+		}
+	}
+	return "", false
+}
+
+// FailureUnaryServerInterceptor fails the unary Infrabin RPCs configured to fail at runtime
+func FailureUnaryServerInterceptor(checker FailureChecker) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		if rpc, ok := strings.CutPrefix(info.FullMethod, "/"+Infrabin_ServiceDesc.ServiceName+"/"); ok && checker.IsFailing(rpc) {
+			return nil, failureError(rpc)
+		}
+		return handler(ctx, req)
+	}
+}
+
+// FailureStreamServerInterceptor fails the streaming Infrabin RPCs configured to fail at runtime
+func FailureStreamServerInterceptor(checker FailureChecker) grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if rpc, ok := strings.CutPrefix(info.FullMethod, "/"+Infrabin_ServiceDesc.ServiceName+"/"); ok && checker.IsFailing(rpc) {
+			return failureError(rpc)
+		}
+		return handler(srv, ss)
+	}
+}
+
+// FailureGatewayMiddleware fails the gateway requests to the RPCs configured to fail at runtime.
+// The gateway calls the service in-process, so the gRPC interceptors are not used.
+func FailureGatewayMiddleware(checker FailureChecker) runtime.Middleware {
+	return func(next runtime.HandlerFunc) runtime.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request, pathParams map[string]string) {
+			if pattern, ok := runtime.HTTPPattern(r.Context()); ok {
+				if rpc, ok := rpcByHTTPPattern()[httpPatternKey(r.Method, pattern.String())]; ok && checker.IsFailing(rpc) {
+					writeStatusError(w, http.StatusServiceUnavailable, failureError(rpc))
+					return
+				}
+			}
+			next(w, r, pathParams)
+		}
+	}
+}
+
+// rpcByHTTPPattern maps the HTTP methods and gateway patterns, in the format of httpPatternKey,
+// to the name of the Infrabin RPC they call. RPCs can share a pattern with different methods,
+// e.g. Intermittent and ResetIntermittent.
+// It is built from the google.api.http annotations, so new RPCs are picked up automatically.
+var rpcByHTTPPattern = sync.OnceValue(func() map[string]string {
+	result := make(map[string]string)
+	methods := File_infrabin_infrabin_proto.Services().ByName("Infrabin").Methods()
+	for i := 0; i < methods.Len(); i++ {
+		method := methods.Get(i)
+		rule, ok := proto.GetExtension(method.Options(), annotations.E_Http).(*annotations.HttpRule)
+		if !ok || rule == nil {
+			continue
+		}
+		for _, binding := range append([]*annotations.HttpRule{rule}, rule.GetAdditionalBindings()...) {
+			result[httpPatternKey(httpRuleMethod(binding), httpRulePattern(binding))] = string(method.Name())
+		}
+	}
+	return result
+})
+
+// httpPatternKey returns the key of rpcByHTTPPattern, e.g. "GET /delay/{duration=*}"
+func httpPatternKey(method, pattern string) string {
+	return method + " " + pattern
+}
+
+// httpRuleMethod returns the HTTP method of the rule
+func httpRuleMethod(rule *annotations.HttpRule) string {
+	switch pattern := rule.GetPattern().(type) {
+	case *annotations.HttpRule_Get:
+		return http.MethodGet
+	case *annotations.HttpRule_Put:
+		return http.MethodPut
+	case *annotations.HttpRule_Post:
+		return http.MethodPost
+	case *annotations.HttpRule_Delete:
+		return http.MethodDelete
+	case *annotations.HttpRule_Patch:
+		return http.MethodPatch
+	case *annotations.HttpRule_Custom:
+		return pattern.Custom.GetKind()
+	}
+	return ""
+}
+
+// httpRuleVariable matches the path template variables without a pattern, e.g. {duration}
+var httpRuleVariable = regexp.MustCompile(`\{([^=}]+)\}`)
+
+// httpRulePattern returns the path template of the rule in the format of runtime.Pattern.String(),
+// e.g. /delay/{duration} becomes /delay/{duration=*}
+func httpRulePattern(rule *annotations.HttpRule) string {
+	var template string
+	switch pattern := rule.GetPattern().(type) {
+	case *annotations.HttpRule_Get:
+		template = pattern.Get
+	case *annotations.HttpRule_Put:
+		template = pattern.Put
+	case *annotations.HttpRule_Post:
+		template = pattern.Post
+	case *annotations.HttpRule_Delete:
+		template = pattern.Delete
+	case *annotations.HttpRule_Patch:
+		template = pattern.Patch
+	case *annotations.HttpRule_Custom:
+		template = pattern.Custom.GetPath()
+	}
+	// path.Clean handles the "//" workaround used for Root
+	return httpRuleVariable.ReplaceAllString(path.Clean(template), "{$1=*}")
+}
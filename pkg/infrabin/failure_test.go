@@ -0,0 +1,160 @@
+package infrabin
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestFailureToggles(t *testing.T) {
+	var toggles FailureToggles
+
+	if toggles.IsFailing("Root") {
+		t.Fatalf("IsFailing() = true on zero value, want false")
+	}
+
+	toggles.Set("Root", true, 0)
+	if !toggles.IsFailing("Root") {
+		t.Errorf("IsFailing() = false after Set(on), want true")
+	}
+	if toggles.IsFailing("Delay") {
+		t.Errorf("IsFailing() = true for another RPC, want false")
+	}
+
+	toggles.Set("Root", false, 0)
+	if toggles.IsFailing("Root") {
+		t.Errorf("IsFailing() = true after Set(off), want false")
+	}
+
+	toggles.Set("Root", true, 20*time.Millisecond)
+	if !toggles.IsFailing("Root") {
+		t.Errorf("IsFailing() = false before ttl elapsed, want true")
+	}
+	time.Sleep(30 * time.Millisecond)
+	if toggles.IsFailing("Root") {
+		t.Errorf("IsFailing() = true after ttl elapsed, want false")
+	}
+}
+
+func TestSetFailure(t *testing.T) {
+	tests := []struct {
+		name        string
+		request     *SetFailureRequest
+		wantErrCode codes.Code
+		wantRPC     string
+		wantFailing bool
+	}{
+		{
+			name:        "on is case insensitive",
+			request:     &SetFailureRequest{Rpc: "root", State: "on"},
+			wantRPC:     "Root",
+			wantFailing: true,
+		},
+		{
+			name:        "on with ttl",
+			request:     &SetFailureRequest{Rpc: "awsmetadata", State: "on", Ttl: "1m"},
+			wantRPC:     "AWSMetadata",
+			wantFailing: true,
+		},
+		{
+			name:        "off",
+			request:     &SetFailureRequest{Rpc: "Delay", State: "off"},
+			wantRPC:     "Delay",
+			wantFailing: false,
+		},
+		{
+			name:        "unknown rpc",
+			request:     &SetFailureRequest{Rpc: "unknown", State: "on"},
+			wantErrCode: codes.InvalidArgument,
+		},
+		{
+			name:        "SetFailure cannot fail",
+			request:     &SetFailureRequest{Rpc: "setfailure", State: "on"},
+			wantErrCode: codes.InvalidArgument,
+		},
+		{
+			name:        "invalid state",
+			request:     &SetFailureRequest{Rpc: "root", State: "fail"},
+			wantErrCode: codes.InvalidArgument,
+		},
+		{
+			name:        "invalid ttl",
+			request:     &SetFailureRequest{Rpc: "root", State: "on", Ttl: "-1s"},
+			wantErrCode: codes.InvalidArgument,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			service := &InfrabinService{}
+			_, err := service.SetFailure(context.Background(), tt.request)
+			if status.Code(err) != tt.wantErrCode {
+				t.Fatalf("SetFailure() error code = %v, want %v", status.Code(err), tt.wantErrCode)
+			}
+			if err != nil {
+				return
+			}
+			if got := service.IsFailing(tt.wantRPC); got != tt.wantFailing {
+				t.Errorf("IsFailing(%s) = %v, want %v", tt.wantRPC, got, tt.wantFailing)
+			}
+		})
+	}
+}
+
+func TestFailureUnaryServerInterceptor(t *testing.T) {
+	service := &InfrabinService{}
+	service.failures.Set("Root", true, 0)
+	interceptor := FailureUnaryServerInterceptor(service)
+	handler := func(ctx context.Context, req any) (any, error) {
+		return &Response{}, nil
+	}
+
+	testCases := []struct {
+		fullMethod   string
+		expectedCode codes.Code
+	}{
+		{fullMethod: "/infrabin.Infrabin/Root", expectedCode: codes.Unavailable},
+		{fullMethod: "/infrabin.Infrabin/Headers", expectedCode: codes.OK},
+		{fullMethod: "/other.Service/Root", expectedCode: codes.OK},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.fullMethod, func(t *testing.T) {
+			_, err := interceptor(context.Background(), &Empty{}, &grpc.UnaryServerInfo{FullMethod: tc.fullMethod}, handler)
+			if status.Code(err) != tc.expectedCode {
+				t.Errorf("interceptor error code = %v, want %v", status.Code(err), tc.expectedCode)
+			}
+		})
+	}
+}
+
+func TestRPCByHTTPPattern(t *testing.T) {
+	testCases := []struct {
+		method  string
+		pattern string
+		wantRPC string
+	}{
+		{method: "GET", pattern: pattern_Infrabin_Root_0.String(), wantRPC: "Root"},
+		{method: "GET", pattern: pattern_Infrabin_Delay_0.String(), wantRPC: "Delay"},
+		{method: "GET", pattern: pattern_Infrabin_AWSMetadata_0.String(), wantRPC: "AWSMetadata"},
+		{method: "GET", pattern: pattern_Infrabin_EgressHTTPSInsecure_0.String(), wantRPC: "EgressHTTPSInsecure"},
+		{method: "POST", pattern: pattern_Infrabin_Status_1.String(), wantRPC: "Status"},
+		{method: "POST", pattern: pattern_Infrabin_SetFailure_0.String(), wantRPC: "SetFailure"},
+		{method: "GET", pattern: pattern_Infrabin_Intermittent_1.String(), wantRPC: "Intermittent"},
+		{method: "DELETE", pattern: pattern_Infrabin_ResetIntermittent_1.String(), wantRPC: "ResetIntermittent"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.wantRPC, func(t *testing.T) {
+			key := httpPatternKey(tc.method, tc.pattern)
+			if got := rpcByHTTPPattern()[key]; got != tc.wantRPC {
+				t.Errorf("rpcByHTTPPattern()[%q] = %q, want %q", key, got, tc.wantRPC)
+			}
+		})
+	}
+}
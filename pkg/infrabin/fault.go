@@ -0,0 +1,273 @@
+package infrabin
+
+import (
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"regexp"
+	"time"
+
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"github.com/spf13/viper"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/maruina/go-infrabin/internal/helpers"
+)
+
+// FaultRule describes a fault to inject into the requests it matches, similar to an Istio fault injection.
+//
+// A rule matches HTTP requests when Path is set, and gRPC requests when RPC is set.
+// A rule without Path and RPC matches both. All the Headers must match.
+type FaultRule struct {
+	// Name identifies the rule in the error messages.
+	Name string `mapstructure:"name"`
+	// Path is a regexp matched against the HTTP request path.
+	Path string `mapstructure:"path"`
+	// RPC is a regexp matched against the gRPC full method name, e.g. /infrabin.Infrabin/Root.
+	RPC string `mapstructure:"rpc"`
+	// Headers maps HTTP header or gRPC metadata names to regexps matched against their values.
+	Headers map[string]string `mapstructure:"headers"`
+	// Delay delays the request before it is processed.
+	Delay *FaultDelay `mapstructure:"delay"`
+	// Abort aborts the request with an error instead of processing it.
+	Abort *FaultAbort `mapstructure:"abort"`
+
+	path    *regexp.Regexp
+	rpc     *regexp.Regexp
+	headers map[string]*regexp.Regexp
+}
+
+// FaultDelay delays a percentage of the matching requests. The delay is capped by maxDelay.
+type FaultDelay struct {
+	// Duration is the delay to add to the request.
+	Duration time.Duration `mapstructure:"duration"`
+	// Percentage of the matching requests to delay. Defaults to 100.
+	Percentage *float64 `mapstructure:"percentage"`
+}
+
+// FaultAbort aborts a percentage of the matching requests.
+// When only one of HTTPStatus or GRPCStatus is set, the other one is mapped from it.
+type FaultAbort struct {
+	// HTTPStatus is the HTTP status code returned to HTTP requests.
+	HTTPStatus int `mapstructure:"httpStatus"`
+	// GRPCStatus is the gRPC status code returned to gRPC requests.
+	GRPCStatus *int `mapstructure:"grpcStatus"`
+	// Percentage of the matching requests to abort. Defaults to 100.
+	Percentage *float64 `mapstructure:"percentage"`
+}
+
+// FaultInjector injects the faults described by its rules in HTTP and gRPC requests.
+// Only the first matching rule is applied.
+type FaultInjector struct {
+	Rules []*FaultRule
+}
+
+// NewFaultInjector creates a FaultInjector from the rules in the "faults" configuration key.
+// Returns an error if a rule is invalid.
+func NewFaultInjector() (*FaultInjector, error) {
+	var rules []*FaultRule
+	if err := viper.UnmarshalKey("faults", &rules); err != nil {
+		return nil, fmt.Errorf("failed to parse fault rules: %w", err)
+	}
+	for i, rule := range rules {
+		if err := rule.compile(); err != nil {
+			return nil, fmt.Errorf("invalid fault rule %d (%s): %w", i, rule.Name, err)
+		}
+	}
+	return &FaultInjector{Rules: rules}, nil
+}
+
+// compile validates the rule and compiles its regexps
+func (r *FaultRule) compile() error {
+	if r.Delay == nil && r.Abort == nil {
+		return fmt.Errorf("delay or abort must be set")
+	}
+	if r.Abort != nil {
+		if r.Abort.HTTPStatus == 0 && r.Abort.GRPCStatus == nil {
+			return fmt.Errorf("abort requires httpStatus or grpcStatus")
+		}
+		if r.Abort.HTTPStatus != 0 && (r.Abort.HTTPStatus < http.StatusBadRequest || r.Abort.HTTPStatus > 599) {
+			return fmt.Errorf("abort httpStatus %d must be between 400 and 599", r.Abort.HTTPStatus)
+		}
+		if r.Abort.GRPCStatus != nil && (*r.Abort.GRPCStatus <= int(codes.OK) || *r.Abort.GRPCStatus > int(codes.Unauthenticated)) {
+			return fmt.Errorf("abort grpcStatus %d must be between 1 and 16", *r.Abort.GRPCStatus)
+		}
+	}
+
+	var err error
+	if r.Path != "" {
+		if r.path, err = regexp.Compile(r.Path); err != nil {
+			return fmt.Errorf("unable to compile path regexp: %w", err)
+		}
+	}
+	if r.RPC != "" {
+		if r.rpc, err = regexp.Compile(r.RPC); err != nil {
+			return fmt.Errorf("unable to compile rpc regexp: %w", err)
+		}
+	}
+	r.headers = make(map[string]*regexp.Regexp, len(r.Headers))
+	for name, exp := range r.Headers {
+		if r.headers[name], err = regexp.Compile(exp); err != nil {
+			return fmt.Errorf("unable to compile header %s regexp: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// matchHeaders returns true if all the rule headers match one of the values returned by get
+func (r *FaultRule) matchHeaders(get func(name string) []string) bool {
+	for name, exp := range r.headers {
+		matched := false
+		for _, value := range get(name) {
+			if exp.MatchString(value) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	return true
+}
+
+// matchHTTP returns the first rule matching the HTTP request, or nil
+func (f *FaultInjector) matchHTTP(r *http.Request) *FaultRule {
+	for _, rule := range f.Rules {
+		if rule.rpc != nil && rule.path == nil {
+			continue
+		}
+		if rule.path != nil && !rule.path.MatchString(r.URL.Path) {
+			continue
+		}
+		if rule.matchHeaders(r.Header.Values) {
+			return rule
+		}
+	}
+	return nil
+}
+
+// matchGRPC returns the first rule matching the gRPC method and incoming metadata, or nil
+func (f *FaultInjector) matchGRPC(ctx context.Context, fullMethod string) *FaultRule {
+	md, _ := metadata.FromIncomingContext(ctx)
+	for _, rule := range f.Rules {
+		if rule.path != nil && rule.rpc == nil {
+			continue
+		}
+		if rule.rpc != nil && !rule.rpc.MatchString(fullMethod) {
+			continue
+		}
+		if rule.matchHeaders(md.Get) {
+			return rule
+		}
+	}
+	return nil
+}
+
+// apply delays the request and returns the abort status, if any, according to the rule percentages.
+// Returns an error with the context status if the context is done during the delay.
+func (r *FaultRule) apply(ctx context.Context) (abort *FaultAbort, err error) {
+	if r.Delay != nil && hit(r.Delay.Percentage) {
+		duration := helpers.MinDuration(r.Delay.Duration, viper.GetDuration("maxDelay"))
+		timer := time.NewTimer(duration)
+		defer timer.Stop()
+
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			return nil, status.FromContextError(ctx.Err()).Err()
+		}
+	}
+	if r.Abort != nil && hit(r.Abort.Percentage) {
+		return r.Abort, nil
+	}
+	return nil, nil
+}
+
+// hit returns true with the given percentage of probability. A nil percentage always hits.
+func hit(percentage *float64) bool {
+	if percentage == nil {
+		return true
+	}
+	return rand.Float64()*100 < *percentage
+}
+
+// grpcCode returns the gRPC status code of the abort
+func (a *FaultAbort) grpcCode() codes.Code {
+	if a.GRPCStatus != nil {
+		return codes.Code(*a.GRPCStatus)
+	}
+	return grpcCodeFromHTTPStatus(a.HTTPStatus)
+}
+
+// httpStatus returns the HTTP status code of the abort
+func (a *FaultAbort) httpStatus() int {
+	if a.HTTPStatus != 0 {
+		return a.HTTPStatus
+	}
+	return runtime.HTTPStatusFromCode(a.grpcCode())
+}
+
+// statusError returns the gRPC error of the abort for the given rule
+func (a *FaultAbort) statusError(rule *FaultRule) error {
+	return status.Errorf(a.grpcCode(), "fault injected by rule %s", rule.Name)
+}
+
+// HTTPMiddleware injects faults in the HTTP requests matching a rule.
+// Aborted requests return the same JSON error body as the gateway.
+func (f *FaultInjector) HTTPMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rule := f.matchHTTP(r)
+		if rule == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		abort, err := rule.apply(r.Context())
+		if err == nil && abort != nil {
+			err = abort.statusError(rule)
+		}
+		if err == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		httpStatus := runtime.HTTPStatusFromCode(status.Code(err))
+		if abort != nil {
+			httpStatus = abort.httpStatus()
+		}
+		writeStatusError(w, httpStatus, err)
+	})
+}
+
+// UnaryServerInterceptor injects faults in the unary gRPC requests matching a rule
+func (f *FaultInjector) UnaryServerInterceptor(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	if rule := f.matchGRPC(ctx, info.FullMethod); rule != nil {
+		abort, err := rule.apply(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if abort != nil {
+			return nil, abort.statusError(rule)
+		}
+	}
+	return handler(ctx, req)
+}
+
+// StreamServerInterceptor injects faults in the streaming gRPC requests matching a rule
+func (f *FaultInjector) StreamServerInterceptor(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	if rule := f.matchGRPC(ss.Context(), info.FullMethod); rule != nil {
+		abort, err := rule.apply(ss.Context())
+		if err != nil {
+			return err
+		}
+		if abort != nil {
+			return abort.statusError(rule)
+		}
+	}
+	return handler(srv, ss)
+}
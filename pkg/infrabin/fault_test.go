@@ -0,0 +1,239 @@
+package infrabin
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func newTestFaultInjector(t *testing.T, rules []map[string]any) *FaultInjector {
+	t.Helper()
+	viper.Set("faults", rules)
+	t.Cleanup(func() { viper.Set("faults", nil) })
+
+	faultInjector, err := NewFaultInjector()
+	if err != nil {
+		t.Fatalf("NewFaultInjector() returned unexpected error: %v", err)
+	}
+	return faultInjector
+}
+
+func TestNewFaultInjectorInvalidRules(t *testing.T) {
+	testCases := []struct {
+		name string
+		rule map[string]any
+		want string
+	}{
+		{
+			name: "no fault",
+			rule: map[string]any{"name": "empty", "path": "/"},
+			want: "delay or abort must be set",
+		},
+		{
+			name: "abort without status",
+			rule: map[string]any{"name": "abort", "abort": map[string]any{"percentage": 10}},
+			want: "abort requires httpStatus or grpcStatus",
+		},
+		{
+			name: "abort with success status",
+			rule: map[string]any{"name": "abort", "abort": map[string]any{"httpStatus": 200}},
+			want: "must be between 400 and 599",
+		},
+		{
+			name: "abort with OK grpc status",
+			rule: map[string]any{"name": "abort", "abort": map[string]any{"grpcStatus": 0}},
+			want: "must be between 1 and 16",
+		},
+		{
+			name: "invalid path regexp",
+			rule: map[string]any{"name": "regexp", "path": "(", "abort": map[string]any{"httpStatus": 503}},
+			want: "unable to compile path regexp",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			viper.Set("faults", []map[string]any{tc.rule})
+			defer viper.Set("faults", nil)
+
+			_, err := NewFaultInjector()
+			if err == nil {
+				t.Fatalf("NewFaultInjector() expected error but got none")
+			}
+			if !strings.Contains(err.Error(), tc.want) {
+				t.Errorf("NewFaultInjector() error = %v, want to contain %v", err, tc.want)
+			}
+		})
+	}
+}
+
+func TestFaultInjectorHTTPMiddleware(t *testing.T) {
+	viper.Set("maxDelay", 10*time.Second)
+	faultInjector := newTestFaultInjector(t, []map[string]any{
+		{
+			"name":    "header-abort",
+			"path":    "^/headers",
+			"headers": map[string]string{"x-fault": "^abort$"},
+			"abort":   map[string]any{"httpStatus": 502},
+		},
+		{
+			"name":  "grpc-only",
+			"rpc":   "Root",
+			"abort": map[string]any{"grpcStatus": 14},
+		},
+		{
+			"name":  "env-abort",
+			"path":  "^/env",
+			"abort": map[string]any{"grpcStatus": 8, "percentage": 100},
+		},
+		{
+			"name":  "delay",
+			"path":  "^/delay",
+			"delay": map[string]any{"duration": "50ms"},
+		},
+	})
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	handler := faultInjector.HTTPMiddleware(next)
+
+	testCases := []struct {
+		name           string
+		path           string
+		headers        map[string]string
+		expectedStatus int
+		minDuration    time.Duration
+	}{
+		{
+			name:           "matching path and header aborts",
+			path:           "/headers",
+			headers:        map[string]string{"X-Fault": "abort"},
+			expectedStatus: http.StatusBadGateway,
+		},
+		{
+			name:           "matching path without header passes",
+			path:           "/headers",
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "gRPC only rule does not match HTTP requests",
+			path:           "/",
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "grpc status is mapped to HTTP status",
+			path:           "/env/HOME",
+			expectedStatus: http.StatusTooManyRequests,
+		},
+		{
+			name:           "delay then passes",
+			path:           "/delay/0",
+			expectedStatus: http.StatusOK,
+			minDuration:    50 * time.Millisecond,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", tc.path, nil)
+			for key, value := range tc.headers {
+				req.Header.Set(key, value)
+			}
+
+			rr := httptest.NewRecorder()
+			start := time.Now()
+			handler.ServeHTTP(rr, req)
+
+			if rr.Code != tc.expectedStatus {
+				t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, tc.expectedStatus)
+			}
+			if elapsed := time.Since(start); elapsed < tc.minDuration {
+				t.Errorf("handler returned after %v, want at least %v", elapsed, tc.minDuration)
+			}
+		})
+	}
+}
+
+func TestFaultInjectorUnaryServerInterceptor(t *testing.T) {
+	faultInjector := newTestFaultInjector(t, []map[string]any{
+		{
+			"name":  "http-only",
+			"path":  ".*",
+			"abort": map[string]any{"httpStatus": 500},
+		},
+		{
+			"name":    "root-abort",
+			"rpc":     "^/infrabin.Infrabin/Root$",
+			"headers": map[string]string{"x-fault": "abort"},
+			"abort":   map[string]any{"httpStatus": 504},
+		},
+	})
+	handler := func(ctx context.Context, req any) (any, error) {
+		return &Response{}, nil
+	}
+
+	testCases := []struct {
+		name         string
+		fullMethod   string
+		md           metadata.MD
+		expectedCode codes.Code
+	}{
+		{
+			name:         "matching method and metadata aborts",
+			fullMethod:   "/infrabin.Infrabin/Root",
+			md:           metadata.Pairs("x-fault", "abort"),
+			expectedCode: codes.DeadlineExceeded,
+		},
+		{
+			name:         "matching method without metadata passes",
+			fullMethod:   "/infrabin.Infrabin/Root",
+			expectedCode: codes.OK,
+		},
+		{
+			name:         "other method passes",
+			fullMethod:   "/infrabin.Infrabin/Headers",
+			md:           metadata.Pairs("x-fault", "abort"),
+			expectedCode: codes.OK,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := metadata.NewIncomingContext(context.Background(), tc.md)
+			info := &grpc.UnaryServerInfo{FullMethod: tc.fullMethod}
+
+			_, err := faultInjector.UnaryServerInterceptor(ctx, &Empty{}, info, handler)
+			if status.Code(err) != tc.expectedCode {
+				t.Errorf("UnaryServerInterceptor() error code = %v, want %v", status.Code(err), tc.expectedCode)
+			}
+		})
+	}
+}
+
+func TestFaultRuleDelayContextCancellation(t *testing.T) {
+	viper.Set("maxDelay", 10*time.Second)
+	faultInjector := newTestFaultInjector(t, []map[string]any{
+		{"name": "slow", "delay": map[string]any{"duration": "5s"}},
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err := faultInjector.Rules[0].apply(ctx)
+	if status.Code(err) != codes.DeadlineExceeded {
+		t.Errorf("apply() error code = %v, want %v", status.Code(err), codes.DeadlineExceeded)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("apply() took too long to cancel: %v, should be less than 1s", elapsed)
+	}
+}
@@ -8,6 +8,7 @@ import (
 
 	grpc_prometheus "github.com/grpc-ecosystem/go-grpc-prometheus"
 	"github.com/maruina/go-infrabin/internal/aws"
+	"github.com/maruina/go-infrabin/internal/helpers"
 	"github.com/spf13/viper"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/health"
@@ -70,10 +71,22 @@ func (s *GRPCServer) Shutdown() {
 // NewGRPCServer creates a new gRPC server.
 // Returns an error if server initialization fails.
 func NewGRPCServer() (*GRPCServer, error) {
-	gs := grpc.NewServer(
-		grpc.StreamInterceptor(grpc_prometheus.StreamServerInterceptor),
-		grpc.UnaryInterceptor(grpc_prometheus.UnaryServerInterceptor),
-	)
+	faultInjector, err := NewFaultInjector()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create fault injector: %w", err)
+	}
+
+	// grpc.NewServer does not validate the message sizes, a negative size would reject every message
+	maxRecvMsgSize := viper.GetInt("grpc.maxRecvMsgSize")
+	maxSendMsgSize := viper.GetInt("grpc.maxSendMsgSize")
+	if maxRecvMsgSize <= 0 || maxSendMsgSize <= 0 {
+		return nil, fmt.Errorf("invalid gRPC max message sizes %d and %d: must be positive", maxRecvMsgSize, maxSendMsgSize)
+	}
+
+	trustedProxies, err := ParseTrustedProxies(viper.GetStringSlice("trustedProxies"))
+	if err != nil {
+		return nil, err
+	}
 
 	// Create the gRPC services
 	healthServer := health.NewServer()
@@ -85,6 +98,26 @@ func NewGRPCServer() (*GRPCServer, error) {
 		STSClient:     stsClient,
 		HealthService: healthServer,
 	}
+	// FAIL_ROOT_HANDLER is the initial state of the Root failure toggle, restored with SetFailure
+	if helpers.GetEnv("FAIL_ROOT_HANDLER", "") != "" {
+		infrabinService.failures.Set("Root", true, 0)
+	}
+
+	gs := grpc.NewServer(
+		grpc.MaxRecvMsgSize(maxRecvMsgSize),
+		grpc.MaxSendMsgSize(maxSendMsgSize),
+		grpc.ChainStreamInterceptor(
+			grpc_prometheus.StreamServerInterceptor,
+			faultInjector.StreamServerInterceptor,
+			FailureStreamServerInterceptor(infrabinService),
+		),
+		grpc.ChainUnaryInterceptor(
+			grpc_prometheus.UnaryServerInterceptor,
+			faultInjector.UnaryServerInterceptor,
+			FailureUnaryServerInterceptor(infrabinService),
+			trustedProxiesUnaryServerInterceptor(trustedProxies),
+		),
+	)
 
 	// Register gRPC services on the grpc server
 	RegisterInfrabinServer(gs, infrabinService)
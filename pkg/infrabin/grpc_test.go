@@ -1,7 +1,17 @@
 package infrabin
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net"
 	"testing"
+
+	"github.com/spf13/viper"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
 )
 
 func TestNewGRPCServer(t *testing.T) {
@@ -13,3 +23,98 @@ func TestNewGRPCServer(t *testing.T) {
 		t.Errorf("Name not set on GRPCServer. got %v want %v", server.Name, "grpc")
 	}
 }
+
+func TestNewGRPCServerInvalidMaxMsgSize(t *testing.T) {
+	defer viper.Set("grpc.maxRecvMsgSize", GRPCMaxRecvMsgSize)
+	defer viper.Set("grpc.maxSendMsgSize", GRPCMaxSendMsgSize)
+
+	for _, sizes := range [][2]int{{0, GRPCMaxSendMsgSize}, {GRPCMaxRecvMsgSize, -1}} {
+		viper.Set("grpc.maxRecvMsgSize", sizes[0])
+		viper.Set("grpc.maxSendMsgSize", sizes[1])
+		if _, err := NewGRPCServer(); err == nil {
+			t.Errorf("NewGRPCServer() with max message sizes %d and %d succeeded, want an error", sizes[0], sizes[1])
+		}
+	}
+}
+
+// newTestGRPCClient serves a new gRPC server on a local port and returns a client connected to it
+func newTestGRPCClient(t *testing.T) InfrabinClient {
+	t.Helper()
+	server, err := NewGRPCServer()
+	if err != nil {
+		t.Fatalf("NewGRPCServer() returned error: %v", err)
+	}
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen() returned error: %v", err)
+	}
+	go server.ListenAndServe(lis)
+	t.Cleanup(server.Server.Stop)
+
+	conn, err := grpc.NewClient(lis.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("NewClient() returned error: %v", err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+	return NewInfrabinClient(conn)
+}
+
+func TestGRPCServerMaxMsgSize(t *testing.T) {
+	viper.Set("maxBytesSize", MaxBytesSize)
+	viper.Set("grpc.maxRecvMsgSize", 1024)
+	viper.Set("grpc.maxSendMsgSize", 2048)
+	defer viper.Set("grpc.maxRecvMsgSize", GRPCMaxRecvMsgSize)
+	defer viper.Set("grpc.maxSendMsgSize", GRPCMaxSendMsgSize)
+	client := newTestGRPCClient(t)
+	ctx := context.Background()
+
+	response, err := client.Payload(ctx, &PayloadRequest{Size: 1024, Data: make([]byte, 512)})
+	if err != nil {
+		t.Fatalf("Payload() error = %v", err)
+	}
+	if len(response.Data) != 1024 || response.Received != 512 {
+		t.Errorf("Payload() returned %d bytes and received %d, want 1024 and 512", len(response.Data), response.Received)
+	}
+	if _, err := client.Payload(ctx, &PayloadRequest{Data: make([]byte, 2048)}); status.Code(err) != codes.ResourceExhausted {
+		t.Errorf("Payload() over the receive limit error = %v, want %v", err, codes.ResourceExhausted)
+	}
+	if _, err := client.Payload(ctx, &PayloadRequest{Size: 4096}); status.Code(err) != codes.ResourceExhausted {
+		t.Errorf("Payload() over the send limit error = %v, want %v", err, codes.ResourceExhausted)
+	}
+}
+
+func TestGRPCUpload(t *testing.T) {
+	viper.Set("grpc.maxRecvMsgSize", GRPCMaxRecvMsgSize)
+	viper.Set("grpc.maxSendMsgSize", GRPCMaxSendMsgSize)
+	client := newTestGRPCClient(t)
+
+	stream, err := client.Upload(context.Background())
+	if err != nil {
+		t.Fatalf("Upload() error = %v", err)
+	}
+	hash := sha256.New()
+	for _, data := range []string{"infra", "bin", ""} {
+		if err := stream.Send(&UploadChunk{Data: []byte(data)}); err != nil {
+			t.Fatalf("Send() error = %v", err)
+		}
+		hash.Write([]byte(data))
+	}
+	response, err := stream.CloseAndRecv()
+	if err != nil {
+		t.Fatalf("CloseAndRecv() error = %v", err)
+	}
+	if response.Messages != 3 || response.Bytes != 8 || response.Sha256 != hex.EncodeToString(hash.Sum(nil)) {
+		t.Errorf("unexpected upload response: %v", response)
+	}
+}
+
+func TestGRPCUploadBodyMaxSize(t *testing.T) {
+	viper.Set("grpc.maxRecvMsgSize", GRPCMaxRecvMsgSize)
+	viper.Set("grpc.maxSendMsgSize", GRPCMaxSendMsgSize)
+	client := newTestGRPCClient(t)
+
+	_, err := client.UploadBody(context.Background(), &UploadBodyRequest{Data: []byte("infrabin"), MaxSize: 7})
+	if status.Code(err) != codes.ResourceExhausted {
+		t.Errorf("UploadBody() error = %v, want code %v", err, codes.ResourceExhausted)
+	}
+}
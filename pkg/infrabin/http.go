@@ -4,36 +4,75 @@ import (
 	"context"
 	_ "embed"
 	"fmt"
+	"io"
 	"log"
 	"net/http"
+	"net/netip"
 	"os"
+	"strconv"
+	"strings"
 
 	"github.com/gorilla/handlers"
 	"github.com/spf13/viper"
+	"google.golang.org/genproto/googleapis/api/httpbody"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
 
 	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
 )
 
+// HTTPCodeHeader is the gRPC header an RPC can set to override the HTTP status code returned by the gateway.
+const HTTPCodeHeader = "x-http-code"
+
+// HTTPHeaderPrefix is the prefix of the gRPC headers an RPC can set to add headers to the HTTP response
+// returned by the gateway, e.g. "x-http-header-cache-control".
+const HTTPHeaderPrefix = "x-http-header-"
+
 //go:embed openapi.swagger.json
 var openAPISpec []byte
 
 type HTTPServer struct {
 	Name   string
 	Server *http.Server
+
+	// trustedProxies are parsed from the configuration when the server is created
+	trustedProxies []netip.Prefix
 }
 
 type HTTPServerOption func(ctx context.Context, s *HTTPServer) error
 
 func RegisterInfrabin(pattern string, infrabinService InfrabinServer) HTTPServerOption {
 	return func(ctx context.Context, s *HTTPServer) error {
+		// Fail the RPCs configured to fail at runtime
+		var muxOptions []runtime.ServeMuxOption
+		if checker, ok := infrabinService.(FailureChecker); ok {
+			muxOptions = append(muxOptions, runtime.WithMiddlewares(FailureGatewayMiddleware(checker)))
+		}
+
 		// Register the handler to call local instance, i.e. no network calls
-		gatewayMux := newGatewayMux()
+		gatewayMux := newGatewayMux(muxOptions...)
 		if err := RegisterInfrabinHandlerServer(ctx, gatewayMux, infrabinService); err != nil {
 			return fmt.Errorf("failed to register infrabin handler: %w", err)
 		}
+		registerInfrabinStreamHandlers(gatewayMux, infrabinService)
+		registerInfrabinUploadHandlers(gatewayMux, infrabinService)
+
+		// Wrap with fault injection middleware
+		faultInjector, err := NewFaultInjector()
+		if err != nil {
+			return fmt.Errorf("failed to create fault injector: %w", err)
+		}
+		handler := faultInjector.HTTPMiddleware(withHTTPRequest(withResponseFormat(gatewayMux)))
+
+		// Compress the responses if enabled
+		if viper.GetBool("compression") {
+			handler = CompressionMiddleware(handler)
+		}
 
 		// Wrap with metrics middleware
-		handler := HTTPMetricsMiddleware(gatewayMux)
+		handler = HTTPMetricsMiddleware(handler)
 
 		// Register the handler on the HTTP server's ServeMux
 		serveMux, ok := s.Server.Handler.(*http.ServeMux)
@@ -75,8 +114,10 @@ func RegisterOpenAPI(pattern string) HTTPServerOption {
 
 func (s *HTTPServer) ListenAndServe() {
 	// Wrap handler now that everything is registered
-	handler := handlers.CustomLoggingHandler(os.Stdout, s.Server.Handler, RequestLoggingFormatter)
+	handler := withAccessLogFields(handlers.CustomLoggingHandler(os.Stdout, s.Server.Handler, RequestLoggingFormatter))
 	handler = handlers.ProxyHeaders(handler)
+	handler = withPeerAddr(handler)
+	handler = withTrustedProxies(s.trustedProxies, handler)
 	handler = handlers.RecoveryHandler()(handler)
 
 	s.Server.Handler = handler
@@ -107,6 +148,11 @@ func NewHTTPServer(name string, opts ...HTTPServerOption) (*HTTPServer, error) {
 
 	addr := viper.GetString(name+".host") + ":" + viper.GetString(name+".port")
 
+	trustedProxies, err := ParseTrustedProxies(viper.GetStringSlice("trustedProxies"))
+	if err != nil {
+		return nil, err
+	}
+
 	// A standard http.Server
 	server := &http.Server{
 		Handler: http.NewServeMux(),
@@ -118,7 +164,7 @@ func NewHTTPServer(name string, opts ...HTTPServerOption) (*HTTPServer, error) {
 		ReadHeaderTimeout: viper.GetDuration("httpReadHeaderTimeout"),
 	}
 
-	s := &HTTPServer{Name: name, Server: server}
+	s := &HTTPServer{Name: name, Server: server, trustedProxies: trustedProxies}
 	for _, opt := range opts {
 		if err := opt(ctx, s); err != nil {
 			return nil, fmt.Errorf("failed to apply HTTP server option: %w", err)
@@ -127,27 +173,218 @@ func NewHTTPServer(name string, opts ...HTTPServerOption) (*HTTPServer, error) {
 	return s, nil
 }
 
-func newGatewayMux() *runtime.ServeMux {
-	mux := runtime.NewServeMux(
+func newGatewayMux(opts ...runtime.ServeMuxOption) *runtime.ServeMux {
+	// Same as the default marshaler, except for the marshal options and the raw request bodies
+	jsonMarshaler := &runtime.JSONPb{
+		MarshalOptions: protojson.MarshalOptions{
+			EmitUnpopulated: false,
+			UseProtoNames:   true,
+		},
+		UnmarshalOptions: protojson.UnmarshalOptions{
+			DiscardUnknown: true,
+		},
+	}
+	// The response marshaler is selected by the Accept header, see withResponseFormat,
+	// and the request marshaler by the Content-Type of the request
+	marshalers := map[string]runtime.Marshaler{
+		runtime.MIMEWildcard: jsonMarshaler,
+		"application/json":   jsonMarshaler,
+		MIMEProtobuf:         &protoMarshaler{},
+		MIMEYAML:             &yamlMarshaler{JSONPb: jsonMarshaler},
+		MIMEText:             &textMarshaler{JSONPb: jsonMarshaler},
+	}
+	var muxOptions []runtime.ServeMuxOption
+	for mime, marshaler := range marshalers {
+		muxOptions = append(muxOptions, runtime.WithMarshalerOption(mime, &runtime.HTTPBodyMarshaler{
+			Marshaler: &rawBodyMarshaler{Marshaler: marshaler},
+		}))
+	}
+
+	return runtime.NewServeMux(append(append(muxOptions,
 		runtime.WithIncomingHeaderMatcher(passThroughHeaderMatcher),
-	)
-	// Set default marshaller options
-	marshaler, _ := runtime.MarshalerForRequest(mux, &http.Request{})
-	jsonMarshaler := marshaler.(*runtime.HTTPBodyMarshaler).Marshaler.(*runtime.JSONPb)
-	jsonMarshaler.EmitUnpopulated = false
-	jsonMarshaler.UseProtoNames = true
-	return mux
+		runtime.WithMetadata(originalAcceptMetadata),
+		runtime.WithOutgoingHeaderMatcher(outgoingHeaderMatcher),
+		runtime.WithForwardResponseOption(httpBodyLogger),
+		// The headers must be set before httpCodeResponseModifier writes them
+		runtime.WithForwardResponseOption(httpHeaderResponseModifier),
+		runtime.WithForwardResponseOption(httpCodeResponseModifier),
+		runtime.WithErrorHandler(httpCodeErrorHandler),
+	), opts...)...)
+}
+
+// rawBodyMarshaler decodes the request bodies mapped to a google.api.HttpBody field as raw bytes,
+// instead of parsing them with the wrapped Marshaler.
+type rawBodyMarshaler struct {
+	runtime.Marshaler
+}
+
+// The raw bodies are buffered in memory, so they are limited to the maxBodySize configuration.
+func (m *rawBodyMarshaler) NewDecoder(r io.Reader) runtime.Decoder {
+	return runtime.DecoderFunc(func(v any) error {
+		// The gateway decodes the body field into a pointer to the field
+		if body, ok := v.(**httpbody.HttpBody); ok {
+			maxSize := viper.GetInt64("maxBodySize")
+			data, err := io.ReadAll(io.LimitReader(r, maxSize+1))
+			if err != nil {
+				return err
+			}
+			if int64(len(data)) > maxSize {
+				// Let httpCodeErrorHandler return 413 instead of the 400 of the decoding errors
+				if rb, ok := r.(*requestBody); ok {
+					rb.tooLarge = true
+				}
+				return fmt.Errorf("the body is larger than %d bytes", maxSize)
+			}
+			*body = &httpbody.HttpBody{Data: data}
+			return nil
+		}
+		return m.Marshaler.NewDecoder(r).Decode(v)
+	})
+}
+
+// httpRequestKey is the context key of the HTTP request received by the gateway
+type httpRequestKey struct{}
+
+// withHTTPRequest stores the HTTP request in its context, so that the RPCs called in-process
+// by the gateway can describe the original request, e.g. Anything.
+func withHTTPRequest(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.Body = &requestBody{ReadCloser: r.Body}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), httpRequestKey{}, r)))
+	})
+}
+
+// requestBody wraps the body of the requests received by the gateway, so that rawBodyMarshaler can tell
+// httpCodeErrorHandler that the body was too large.
+type requestBody struct {
+	io.ReadCloser
+	tooLarge bool
+}
+
+// httpRequestFromContext returns the HTTP request received by the gateway, if the RPC was called by the gateway.
+func httpRequestFromContext(ctx context.Context) (*http.Request, bool) {
+	r, ok := ctx.Value(httpRequestKey{}).(*http.Request)
+	return r, ok
+}
+
+// requestHeader returns the values of a header of the request, from the HTTP request received by the gateway
+// or from the gRPC metadata. The gateway forwards some standard headers with a prefix, e.g. If-None-Match.
+func requestHeader(ctx context.Context, name string) []string {
+	if r, ok := httpRequestFromContext(ctx); ok {
+		return r.Header.Values(name)
+	}
+	md, _ := metadata.FromIncomingContext(ctx)
+	return md.Get(name)
+}
+
+// originalAcceptMetadata passes the Accept header of the request received by the gateway, instead of the one
+// negotiated by withResponseFormat
+func originalAcceptMetadata(ctx context.Context, _ *http.Request) metadata.MD {
+	accept := requestHeader(ctx, "Accept")
+	if len(accept) == 0 {
+		return nil
+	}
+	return metadata.MD{runtime.MetadataPrefix + "accept": accept}
 }
 
 // Keep the standard "Grpc-Metadata-" and well known behaviour
 // All other headers are passed, also with grpcgateway- prefix
+// The Accept header is the one negotiated by withResponseFormat, the original is passed by originalAcceptMetadata
 func passThroughHeaderMatcher(key string) (string, bool) {
+	if key == "Accept" {
+		return "", false
+	}
 	if grpcKey, ok := runtime.DefaultHeaderMatcher(key); ok {
 		return grpcKey, ok
 	}
 	return runtime.MetadataPrefix + key, true
 }
 
+// Keep the standard "Grpc-Metadata-" behaviour, except for HTTPCodeHeader and the HTTPHeaderPrefix headers
+// which are only used internally to set the HTTP status code and headers
+func outgoingHeaderMatcher(key string) (string, bool) {
+	if key == HTTPCodeHeader || strings.HasPrefix(key, HTTPHeaderPrefix) {
+		return "", false
+	}
+	return runtime.MetadataHeaderPrefix + key, true
+}
+
+// httpCodeFromContext returns the HTTP status code set by the RPC in the HTTPCodeHeader header, if any.
+func httpCodeFromContext(ctx context.Context) (int, bool) {
+	md, ok := runtime.ServerMetadataFromContext(ctx)
+	if !ok {
+		return 0, false
+	}
+	values := md.HeaderMD.Get(HTTPCodeHeader)
+	if len(values) == 0 {
+		return 0, false
+	}
+	code, err := strconv.Atoi(values[0])
+	if err != nil {
+		return 0, false
+	}
+	return code, true
+}
+
+// httpCodeResponseModifier sets the HTTP status code of successful responses from the HTTPCodeHeader header.
+func httpCodeResponseModifier(ctx context.Context, w http.ResponseWriter, _ proto.Message) error {
+	if code, ok := httpCodeFromContext(ctx); ok {
+		w.WriteHeader(code)
+	}
+	return nil
+}
+
+// httpHeaderResponseModifier sets the headers of successful responses from the HTTPHeaderPrefix headers.
+// It runs after the gateway sets the Content-Type, so the headers replace the ones set by the gateway.
+func httpHeaderResponseModifier(ctx context.Context, w http.ResponseWriter, _ proto.Message) error {
+	md, ok := runtime.ServerMetadataFromContext(ctx)
+	if !ok {
+		return nil
+	}
+	for key, values := range md.HeaderMD {
+		name, ok := strings.CutPrefix(key, HTTPHeaderPrefix)
+		if !ok {
+			continue
+		}
+		w.Header().Del(name)
+		for _, value := range values {
+			w.Header().Add(name, value)
+		}
+	}
+	return nil
+}
+
+// httpCodeErrorHandler sets the HTTP status code of error responses from the HTTPCodeHeader header,
+// instead of the one mapped from the gRPC status code, e.g. 502 instead of 503 for codes.Unavailable,
+// and their headers from the HTTPHeaderPrefix headers.
+func httpCodeErrorHandler(ctx context.Context, mux *runtime.ServeMux, marshaler runtime.Marshaler, w http.ResponseWriter, r *http.Request, err error) {
+	if code, ok := httpCodeFromContext(ctx); ok {
+		w = &httpCodeResponseWriter{ResponseWriter: w, code: code}
+	} else if body, ok := r.Body.(*requestBody); ok && body.tooLarge {
+		w = &httpCodeResponseWriter{ResponseWriter: w, code: http.StatusRequestEntityTooLarge}
+	}
+	_ = httpHeaderResponseModifier(ctx, w, nil)
+	runtime.DefaultHTTPErrorHandler(ctx, mux, marshaler, w, r, err)
+}
+
+// httpCodeResponseWriter wraps http.ResponseWriter to override the status code
+type httpCodeResponseWriter struct {
+	http.ResponseWriter
+	code int
+}
+
+func (w *httpCodeResponseWriter) WriteHeader(_ int) {
+	w.ResponseWriter.WriteHeader(w.code)
+}
+
+// writeStatusError writes the gRPC status of err as a JSON body, the same way as the gateway
+func writeStatusError(w http.ResponseWriter, httpStatus int, err error) {
+	body, _ := protojson.Marshal(status.Convert(err).Proto())
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(httpStatus)
+	_, _ = w.Write(body)
+}
+
 // Workaround for not being able to specify root as a path
 // See https://github.com/grpc-ecosystem/grpc-gateway/issues/1500
 func init() {
@@ -4,23 +4,30 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
+	"io"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"reflect"
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/gorilla/handlers"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/spf13/viper"
 
 	"github.com/google/go-cmp/cmp"
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
 	"github.com/maruina/go-infrabin/internal/aws"
 	"github.com/maruina/go-infrabin/internal/helpers"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 
 	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/testing/protocmp"
+	"google.golang.org/protobuf/types/known/structpb"
 )
 
 func newHTTPInfrabinHandler() http.Handler {
@@ -28,7 +35,7 @@ func newHTTPInfrabinHandler() http.Handler {
 		"test",
 		RegisterInfrabin("/", &InfrabinService{
 			STSClient: aws.FakeSTSClient{},
-			// intermittentErrorsCounter uses atomic.Int32 zero value
+			// intermittentCounters and failures use their zero values
 		}),
 	)
 	if err != nil {
@@ -70,14 +77,31 @@ func TestRootHandler(t *testing.T) {
 
 func TestFailRootHandler(t *testing.T) {
 	t.Setenv("FAIL_ROOT_HANDLER", "true")
-	req := httptest.NewRequest("GET", "/", nil)
-
-	rr := httptest.NewRecorder()
-	handler := newHTTPInfrabinHandler()
-	handler.ServeHTTP(rr, req)
+	viper.Set("grpc.maxRecvMsgSize", GRPCMaxRecvMsgSize)
+	viper.Set("grpc.maxSendMsgSize", GRPCMaxSendMsgSize)
+	grpcServer, err := NewGRPCServer()
+	if err != nil {
+		t.Fatalf("NewGRPCServer() returned error: %v", err)
+	}
+	srv, err := NewHTTPServer("test", RegisterInfrabin("/", grpcServer.InfrabinService))
+	if err != nil {
+		t.Fatalf("NewHTTPServer() returned error: %v", err)
+	}
 
-	if status := rr.Code; status != http.StatusServiceUnavailable {
-		t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusServiceUnavailable)
+	// The environment variable is the initial state of the toggle, SetFailure restores the RPC
+	for _, step := range []struct {
+		method, path string
+		expected     int
+	}{
+		{method: "GET", path: "/", expected: http.StatusServiceUnavailable},
+		{method: "POST", path: "/fail/root/off", expected: http.StatusOK},
+		{method: "GET", path: "/", expected: http.StatusOK},
+	} {
+		rr := httptest.NewRecorder()
+		srv.Server.Handler.ServeHTTP(rr, httptest.NewRequest(step.method, step.path, nil))
+		if rr.Code != step.expected {
+			t.Errorf("%s %s returned wrong status code: got %v want %v", step.method, step.path, rr.Code, step.expected)
+		}
 	}
 }
 
@@ -135,7 +159,7 @@ func TestDelayHandler(t *testing.T) {
 		t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusOK)
 	}
 
-	expected := Response{Delay: 1}
+	expected := Response{Delay: 1, DelayDuration: "1s"}
 	marshalOptions := protojson.MarshalOptions{UseProtoNames: true}
 	data, _ := marshalOptions.Marshal(&expected)
 
@@ -156,7 +180,7 @@ func TestDelayHandlerBadRequest(t *testing.T) {
 
 	expected := status.New(
 		codes.InvalidArgument,
-		"type mismatch, parameter: duration, error: strconv.ParseInt: parsing \"abc\": invalid syntax",
+		"invalid delay: \"abc\" is not a duration or a number of seconds",
 	)
 	marshalOptions := protojson.MarshalOptions{UseProtoNames: true}
 	expectedBytes, _ := marshalOptions.Marshal(expected.Proto())
@@ -872,6 +896,102 @@ func TestEgressHTTPWithCustomDNS(t *testing.T) {
 	}
 }
 
+func TestEgressTCPHandler(t *testing.T) {
+	viper.Set("egressTimeout", 500*time.Millisecond)
+	defer viper.Set("egressTimeout", EgressTimeout)
+	viper.Set("egressTCPAllowRegexp", `^127\.0\.0\.1:`)
+	defer viper.Set("egressTCPAllowRegexp", EgressTCPAllowRegexp)
+
+	// A mock server sending a banner, then echoing what it receives
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen() error = %v", err)
+	}
+	defer func() { _ = lis.Close() }()
+	go func() {
+		for {
+			conn, err := lis.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer func() { _ = conn.Close() }()
+				_, _ = conn.Write([]byte("220 infrabin ready\r\n"))
+				_, _ = io.Copy(conn, conn)
+			}()
+		}
+	}()
+	target := lis.Addr().String()
+
+	testCases := []struct {
+		name            string
+		query           string
+		expectedSuccess bool
+		expectedBanner  string
+	}{
+		{name: "connect", expectedSuccess: true},
+		{name: "banner", query: "?expect=%5E220%20", expectedSuccess: true, expectedBanner: "220 infrabin ready\r\n"},
+		{name: "send", query: "?send=PING%0D%0A&expect=PING%0D%0A", expectedSuccess: true, expectedBanner: "220 infrabin ready\r\nPING\r\n"},
+		{name: "banner mismatch", query: "?expect=%5E554", expectedSuccess: false, expectedBanner: "220 infrabin ready\r\n"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/egress/tcp/"+target+tc.query, nil)
+			rr := httptest.NewRecorder()
+			handler := newHTTPInfrabinHandler()
+			handler.ServeHTTP(rr, req)
+
+			if rr.Code != http.StatusOK {
+				t.Fatalf("handler returned wrong status code: got %v want %v: %s", rr.Code, http.StatusOK, rr.Body.String())
+			}
+			var got EgressResponse
+			if err := protojson.Unmarshal(rr.Body.Bytes(), &got); err != nil {
+				t.Fatalf("failed to parse response %v: %v", rr.Body.String(), err)
+			}
+			if got.Success != tc.expectedSuccess {
+				t.Errorf("success = %v, want %v, error = %s", got.Success, tc.expectedSuccess, got.Error)
+			}
+			if got.Banner != tc.expectedBanner {
+				t.Errorf("banner = %q, want %q", got.Banner, tc.expectedBanner)
+			}
+			if got.Target != target || got.RemoteAddress != target || got.LocalAddress == "" {
+				t.Errorf("unexpected addresses: target %q, remote %q, local %q", got.Target, got.RemoteAddress, got.LocalAddress)
+			}
+		})
+	}
+}
+
+func TestEgressTCPHandlerFailure(t *testing.T) {
+	viper.Set("egressTimeout", 500*time.Millisecond)
+	defer viper.Set("egressTimeout", EgressTimeout)
+
+	req := httptest.NewRequest("GET", "/egress/tcp/localhost:1", nil)
+	rr := httptest.NewRecorder()
+	handler := newHTTPInfrabinHandler()
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+	}
+	var got EgressResponse
+	if err := protojson.Unmarshal(rr.Body.Bytes(), &got); err != nil {
+		t.Fatalf("failed to parse response %v: %v", rr.Body.String(), err)
+	}
+	if got.Success || got.Error == "" {
+		t.Errorf("expected a failure with an error for connection to invalid port, got %v", &got)
+	}
+
+	// send is blocked by the default egressTCPAllowRegexp
+	for _, path := range []string{"/egress/tcp/localhost", "/egress/tcp/localhost:25?expect=%28", "/egress/tcp/localhost:6379?send=PING%0D%0A"} {
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest("GET", path, nil))
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("%s returned wrong status code: got %v want %v", path, rr.Code, http.StatusBadRequest)
+		}
+	}
+}
+
 func TestParseTargetAndDNS(t *testing.T) {
 	testCases := []struct {
 		name     string
@@ -1044,3 +1164,824 @@ func TestHTTPMetricsCollection(t *testing.T) {
 		}
 	}
 }
+
+func TestStatusHandler(t *testing.T) {
+	testCases := []struct {
+		name           string
+		method         string
+		path           string
+		expectedStatus int
+	}{
+		{
+			name:           "success code",
+			method:         "GET",
+			path:           "/status/201",
+			expectedStatus: http.StatusCreated,
+		},
+		{
+			name:           "redirect code",
+			method:         "GET",
+			path:           "/status/302",
+			expectedStatus: http.StatusFound,
+		},
+		{
+			name:           "client error code",
+			method:         "POST",
+			path:           "/status/429",
+			expectedStatus: http.StatusTooManyRequests,
+		},
+		{
+			name:           "bad gateway is not mapped to service unavailable",
+			method:         "DELETE",
+			path:           "/status/502",
+			expectedStatus: http.StatusBadGateway,
+		},
+		{
+			name:           "gateway timeout",
+			method:         "PUT",
+			path:           "/status/504",
+			expectedStatus: http.StatusGatewayTimeout,
+		},
+		{
+			name:           "weighted list with a single non-zero weight",
+			method:         "GET",
+			path:           "/status/200:0,503:10",
+			expectedStatus: http.StatusServiceUnavailable,
+		},
+		{
+			name:           "invalid code",
+			method:         "GET",
+			path:           "/status/abc",
+			expectedStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(tc.method, tc.path, nil)
+
+			rr := httptest.NewRecorder()
+			handler := newHTTPInfrabinHandler()
+			handler.ServeHTTP(rr, req)
+
+			if rr.Code != tc.expectedStatus {
+				t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, tc.expectedStatus)
+			}
+			if h := rr.Header().Get(runtime.MetadataHeaderPrefix + HTTPCodeHeader); h != "" {
+				t.Errorf("handler leaked internal %s header: %s", HTTPCodeHeader, h)
+			}
+		})
+	}
+}
+
+func TestSetFailureHandler(t *testing.T) {
+	handler := newHTTPInfrabinHandler()
+
+	steps := []struct {
+		method         string
+		path           string
+		expectedStatus int
+	}{
+		{method: "GET", path: "/", expectedStatus: http.StatusOK},
+		{method: "POST", path: "/fail/root/on", expectedStatus: http.StatusOK},
+		{method: "GET", path: "/", expectedStatus: http.StatusServiceUnavailable},
+		{method: "GET", path: "/headers", expectedStatus: http.StatusOK},
+		{method: "POST", path: "/fail/root/off", expectedStatus: http.StatusOK},
+		{method: "GET", path: "/", expectedStatus: http.StatusOK},
+		{method: "POST", path: "/fail/delay/on?ttl=1h", expectedStatus: http.StatusOK},
+		{method: "GET", path: "/delay/0", expectedStatus: http.StatusServiceUnavailable},
+		{method: "POST", path: "/fail/unknown/on", expectedStatus: http.StatusBadRequest},
+	}
+
+	for _, step := range steps {
+		req := httptest.NewRequest(step.method, step.path, nil)
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != step.expectedStatus {
+			t.Errorf("%s %s returned wrong status code: got %v want %v", step.method, step.path, rr.Code, step.expectedStatus)
+		}
+	}
+}
+
+func TestSetFailureHandlerSharedPath(t *testing.T) {
+	handler := newHTTPInfrabinHandler()
+	serve := func(method, path string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest(method, path, nil))
+		return rr
+	}
+
+	// Intermittent and ResetIntermittent share their paths with different methods
+	for _, tc := range []struct {
+		failing string
+		method  string
+		other   string
+	}{
+		{failing: "ResetIntermittent", method: "DELETE", other: "GET"},
+		{failing: "Intermittent", method: "GET", other: "DELETE"},
+	} {
+		t.Run(tc.failing, func(t *testing.T) {
+			if rr := serve("POST", "/fail/"+tc.failing+"/on"); rr.Code != http.StatusOK {
+				t.Fatalf("failed to set the failure: %v %s", rr.Code, rr.Body.String())
+			}
+			defer serve("POST", "/fail/"+tc.failing+"/off")
+
+			if rr := serve(tc.method, "/intermittent/shared"); !strings.Contains(rr.Body.String(), "configured to fail") {
+				t.Errorf("%s /intermittent/shared did not fail: %v %s", tc.method, rr.Code, rr.Body.String())
+			}
+			if rr := serve(tc.other, "/intermittent/shared"); strings.Contains(rr.Body.String(), "configured to fail") {
+				t.Errorf("%s /intermittent/shared failed with %s: %v %s", tc.other, tc.failing, rr.Code, rr.Body.String())
+			}
+		})
+	}
+}
+
+func TestDelayHandlerDistribution(t *testing.T) {
+	viper.Set("maxDelay", 150*time.Millisecond)
+	defer viper.Set("maxDelay", MaxDelay)
+
+	testCases := []struct {
+		name           string
+		path           string
+		expectedStatus int
+		expectedDelay  string
+	}{
+		{
+			name:           "go duration",
+			path:           "/delay/10ms",
+			expectedStatus: http.StatusOK,
+			expectedDelay:  "10ms",
+		},
+		{
+			name:           "uniform capped by max delay",
+			path:           "/delay/1s?distribution=uniform&max=2s",
+			expectedStatus: http.StatusOK,
+			expectedDelay:  "150ms",
+		},
+		{
+			name:           "invalid distribution",
+			path:           "/delay/1s?distribution=poisson",
+			expectedStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", tc.path, nil)
+
+			rr := httptest.NewRecorder()
+			handler := newHTTPInfrabinHandler()
+			handler.ServeHTTP(rr, req)
+
+			if rr.Code != tc.expectedStatus {
+				t.Fatalf("handler returned wrong status code: got %v want %v", rr.Code, tc.expectedStatus)
+			}
+			if tc.expectedDelay == "" {
+				return
+			}
+
+			var response Response
+			if err := protojson.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+				t.Fatalf("failed to unmarshal response: %v", err)
+			}
+			if response.DelayDuration != tc.expectedDelay {
+				t.Errorf("handler returned wrong delay_duration: got %v want %v", response.DelayDuration, tc.expectedDelay)
+			}
+		})
+	}
+}
+
+func TestIntermittentKeyHandler(t *testing.T) {
+	viper.Set("intermittentErrors", 2)
+	handler := newHTTPInfrabinHandler()
+
+	steps := []struct {
+		method         string
+		path           string
+		expectedStatus int
+	}{
+		{method: "GET", path: "/intermittent/a?pattern=fail-after&n=1", expectedStatus: http.StatusOK},
+		{method: "GET", path: "/intermittent/b?pattern=fail-every&n=2&code=429", expectedStatus: http.StatusOK},
+		{method: "GET", path: "/intermittent/a?pattern=fail-after&n=1", expectedStatus: http.StatusServiceUnavailable},
+		{method: "GET", path: "/intermittent/b?pattern=fail-every&n=2&code=429", expectedStatus: http.StatusTooManyRequests},
+		{method: "GET", path: "/intermittent/a?pattern=fail-after&n=1&code=500", expectedStatus: http.StatusInternalServerError},
+		{method: "DELETE", path: "/intermittent/a", expectedStatus: http.StatusOK},
+		{method: "GET", path: "/intermittent/a?pattern=fail-after&n=1", expectedStatus: http.StatusOK},
+		{method: "GET", path: "/intermittent/c?pattern=fail-n-of-m&n=1&m=3", expectedStatus: http.StatusServiceUnavailable},
+		{method: "GET", path: "/intermittent/c?pattern=fail-n-of-m&n=1&m=3", expectedStatus: http.StatusOK},
+		{method: "GET", path: "/intermittent/d?pattern=fail-after&n=0", expectedStatus: http.StatusServiceUnavailable},
+		{method: "GET", path: "/intermittent/d?pattern=fail-after&n=0", expectedStatus: http.StatusServiceUnavailable},
+		{method: "GET", path: "/intermittent/e?n=0", expectedStatus: http.StatusOK},
+		{method: "GET", path: "/intermittent/c?pattern=unknown", expectedStatus: http.StatusBadRequest},
+		{method: "GET", path: "/intermittent/c?code=200", expectedStatus: http.StatusBadRequest},
+	}
+
+	for _, step := range steps {
+		req := httptest.NewRequest(step.method, step.path, nil)
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != step.expectedStatus {
+			t.Errorf("%s %s returned wrong status code: got %v want %v", step.method, step.path, rr.Code, step.expectedStatus)
+		}
+	}
+}
+
+func TestStreamHandler(t *testing.T) {
+	viper.Set("maxDelay", MaxDelay)
+	req := httptest.NewRequest("GET", "/stream/3?interval=10ms", nil)
+
+	rr := httptest.NewRecorder()
+	handler := newHTTPInfrabinHandler()
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+	}
+	if encoding := rr.Header().Get("Transfer-Encoding"); encoding != "chunked" {
+		t.Errorf("handler returned wrong Transfer-Encoding: got %v want chunked", encoding)
+	}
+
+	hostname, _ := os.Hostname()
+	lines := strings.Split(strings.TrimSpace(rr.Body.String()), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("handler returned %d messages, want 3: %s", len(lines), rr.Body.String())
+	}
+	for i, line := range lines {
+		var message struct {
+			Result json.RawMessage `json:"result"`
+		}
+		if err := json.Unmarshal([]byte(line), &message); err != nil {
+			t.Fatalf("failed to parse message %v: %v", line, err)
+		}
+		var got Response
+		if err := protojson.Unmarshal(message.Result, &got); err != nil {
+			t.Fatalf("failed to parse result %s: %v", message.Result, err)
+		}
+		if got.Hostname != hostname || got.Stream.GetSequence() != int32(i+1) || got.Stream.GetCount() != 3 {
+			t.Errorf("message %d = %v, want hostname %s and sequence %d of 3", i, &got, hostname, i+1)
+		}
+	}
+}
+
+func TestStreamHandlerBadRequest(t *testing.T) {
+	for _, path := range []string{"/stream/0", "/stream/10001", "/stream/3?interval=0", "/stream/3?interval=1ms", "/stream/3?interval=-1s"} {
+		req := httptest.NewRequest("GET", path, nil)
+
+		rr := httptest.NewRecorder()
+		handler := newHTTPInfrabinHandler()
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("%s returned wrong status code: got %v want %v", path, rr.Code, http.StatusBadRequest)
+		}
+	}
+}
+
+func TestStreamHandlerWriteTimeout(t *testing.T) {
+	viper.Set("maxDelay", MaxDelay)
+	viper.Set("httpWriteTimeout", 100*time.Millisecond)
+	defer viper.Set("httpWriteTimeout", HTTPWriteTimeout)
+
+	server := httptest.NewUnstartedServer(newHTTPInfrabinHandler())
+	server.Config.WriteTimeout = 100 * time.Millisecond
+	server.Start()
+	defer server.Close()
+
+	// The stream takes 300ms, longer than the write timeout
+	resp, err := http.Get(server.URL + "/stream/4?interval=100ms")
+	if err != nil {
+		t.Fatalf("GET /stream failed: %v", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("failed to read the stream: %v", err)
+	}
+	if lines := strings.Split(strings.TrimSpace(string(body)), "\n"); len(lines) != 4 {
+		t.Errorf("stream returned %d messages, want 4: %s", len(lines), body)
+	}
+}
+
+func TestAnythingHandler(t *testing.T) {
+	testCases := []struct {
+		name     string
+		method   string
+		path     string
+		body     string
+		headers  map[string]string
+		expected *AnythingResponse
+	}{
+		{
+			name:    "GET with query",
+			method:  "GET",
+			path:    "/anything/foo/bar?a=1&a=2",
+			headers: map[string]string{"X-Test": "value"},
+			expected: &AnythingResponse{
+				Method:     "GET",
+				Url:        "http://example.com/anything/foo/bar?a=1&a=2",
+				Args:       map[string]string{"a": "1,2"},
+				Headers:    map[string]string{"Host": "example.com", "X-Test": "value"},
+				RemoteAddr: "192.0.2.1:1234",
+				Proto:      "HTTP/1.1",
+			},
+		},
+		{
+			name:    "POST JSON body",
+			method:  "POST",
+			path:    "/anything",
+			body:    `{"key":"value"}`,
+			headers: map[string]string{"Content-Type": "application/json"},
+			expected: &AnythingResponse{
+				Method:     "POST",
+				Url:        "http://example.com/anything",
+				Args:       map[string]string{},
+				Headers:    map[string]string{"Host": "example.com", "Content-Type": "application/json"},
+				Data:       `{"key":"value"}`,
+				Json:       structpb.NewStructValue(&structpb.Struct{Fields: map[string]*structpb.Value{"key": structpb.NewStringValue("value")}}),
+				RemoteAddr: "192.0.2.1:1234",
+				Proto:      "HTTP/1.1",
+			},
+		},
+		{
+			name:    "PATCH form body",
+			method:  "PATCH",
+			path:    "/anything/form",
+			body:    "a=1&b=2",
+			headers: map[string]string{"Content-Type": "application/x-www-form-urlencoded"},
+			expected: &AnythingResponse{
+				Method:     "PATCH",
+				Url:        "http://example.com/anything/form",
+				Args:       map[string]string{},
+				Headers:    map[string]string{"Host": "example.com", "Content-Type": "application/x-www-form-urlencoded"},
+				Data:       "a=1&b=2",
+				Form:       map[string]string{"a": "1", "b": "2"},
+				RemoteAddr: "192.0.2.1:1234",
+				Proto:      "HTTP/1.1",
+			},
+		},
+		{
+			name:   "DELETE binary body",
+			method: "DELETE",
+			path:   "/anything/binary",
+			body:   "\xff\xfe",
+			expected: &AnythingResponse{
+				Method:     "DELETE",
+				Url:        "http://example.com/anything/binary",
+				Args:       map[string]string{},
+				Headers:    map[string]string{"Host": "example.com"},
+				Data:       "data:application/octet-stream;base64,//4=",
+				RemoteAddr: "192.0.2.1:1234",
+				Proto:      "HTTP/1.1",
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(tc.method, tc.path, strings.NewReader(tc.body))
+			for key, value := range tc.headers {
+				req.Header.Set(key, value)
+			}
+
+			rr := httptest.NewRecorder()
+			handler := newHTTPInfrabinHandler()
+			handler.ServeHTTP(rr, req)
+
+			if rr.Code != http.StatusOK {
+				t.Fatalf("handler returned wrong status code: got %v want %v: %s", rr.Code, http.StatusOK, rr.Body.String())
+			}
+			var got Response
+			if err := protojson.Unmarshal(rr.Body.Bytes(), &got); err != nil {
+				t.Fatalf("failed to parse response %v: %v", rr.Body.String(), err)
+			}
+			if diff := cmp.Diff(tc.expected, got.Anything, protocmp.Transform()); diff != "" {
+				t.Errorf("unexpected difference (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestAnythingHandlerMethods(t *testing.T) {
+	for _, method := range []string{"GET", "POST", "PUT", "PATCH", "DELETE", "HEAD", "OPTIONS"} {
+		req := httptest.NewRequest(method, "/anything/methods", nil)
+		rr := httptest.NewRecorder()
+		handler := newHTTPInfrabinHandler()
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusOK {
+			t.Errorf("%s /anything/methods returned wrong status code: got %v want %v", method, rr.Code, http.StatusOK)
+		}
+	}
+}
+
+func TestAnythingHandlerMaxBodySize(t *testing.T) {
+	viper.Set("maxBodySize", 8)
+	defer viper.Set("maxBodySize", MaxBodySize)
+
+	testCases := []struct {
+		body           string
+		expectedStatus int
+	}{
+		{body: "12345678", expectedStatus: http.StatusOK},
+		{body: "123456789", expectedStatus: http.StatusRequestEntityTooLarge},
+	}
+	for _, tc := range testCases {
+		req := httptest.NewRequest("POST", "/anything", strings.NewReader(tc.body))
+		rr := httptest.NewRecorder()
+		handler := newHTTPInfrabinHandler()
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != tc.expectedStatus {
+			t.Errorf("%d bytes body returned wrong status code: got %v want %v: %s", len(tc.body), rr.Code, tc.expectedStatus, rr.Body.String())
+		}
+	}
+}
+
+func TestResponseHeadersHandler(t *testing.T) {
+	req := httptest.NewRequest("GET", "/response-headers?X-Test=a&X-Test=b&Content-Type=text/plain", nil)
+	rr := httptest.NewRecorder()
+	handler := newHTTPInfrabinHandler()
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("handler returned wrong status code: got %v want %v: %s", rr.Code, http.StatusOK, rr.Body.String())
+	}
+	if got := rr.Header().Values("X-Test"); !cmp.Equal(got, []string{"a", "b"}) {
+		t.Errorf("X-Test header = %v, want [a b]", got)
+	}
+	if got := rr.Header().Get("Content-Type"); got != "text/plain" {
+		t.Errorf("Content-Type header = %q, want %q", got, "text/plain")
+	}
+	for name := range rr.Header() {
+		if strings.HasPrefix(strings.ToLower(name), runtime.MetadataHeaderPrefix) {
+			t.Errorf("handler leaked internal header %s", name)
+		}
+	}
+	var got Response
+	if err := protojson.Unmarshal(rr.Body.Bytes(), &got); err != nil {
+		t.Fatalf("failed to parse response %v: %v", rr.Body.String(), err)
+	}
+	expected := map[string]string{"X-Test": "a,b", "Content-Type": "text/plain"}
+	if diff := cmp.Diff(expected, got.ResponseHeaders); diff != "" {
+		t.Errorf("unexpected difference (-want +got):\n%s", diff)
+	}
+}
+
+func TestResponseHeadersHandlerInvalid(t *testing.T) {
+	for _, path := range []string{"/response-headers?Content-Length=1", "/response-headers?Transfer-Encoding=chunked", "/response-headers?X-Test=%0Abad", "/response-headers?X%2BTest=a"} {
+		req := httptest.NewRequest("GET", path, nil)
+		rr := httptest.NewRecorder()
+		handler := newHTTPInfrabinHandler()
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("%s returned wrong status code: got %v want %v", path, rr.Code, http.StatusBadRequest)
+		}
+	}
+}
+
+func TestCustomResponseHandler(t *testing.T) {
+	testCases := []struct {
+		name                string
+		method              string
+		path                string
+		body                string
+		expectedStatus      int
+		expectedContentType string
+		expectedHeaders     map[string]string
+		expectedBody        string
+	}{
+		{
+			name:                "defaults",
+			method:              "GET",
+			path:                "/response",
+			expectedStatus:      http.StatusOK,
+			expectedContentType: DefaultResponseContentType,
+		},
+		{
+			name:                "literal body with status and headers",
+			method:              "GET",
+			path:                "/response?status=418&header=X-Test:%20value&header=Cache-Control:%20no-store&body=teapot",
+			expectedStatus:      http.StatusTeapot,
+			expectedContentType: DefaultResponseContentType,
+			expectedHeaders:     map[string]string{"X-Test": "value", "Cache-Control": "no-store"},
+			expectedBody:        "teapot",
+		},
+		{
+			name:                "content type from header",
+			method:              "GET",
+			path:                "/response?header=Content-Type:%20application/json&body=%7B%7D",
+			expectedStatus:      http.StatusOK,
+			expectedContentType: "application/json",
+			expectedBody:        "{}",
+		},
+		{
+			name:                "template",
+			method:              "POST",
+			path:                "/response",
+			body:                `{"status": 503, "content_type": "application/json", "template": "{\"status\": {{.Status}}, \"method\": \"{{.Request.Method}}\", \"path\": \"{{.Request.Url}}\"}"}`,
+			expectedStatus:      http.StatusServiceUnavailable,
+			expectedContentType: "application/json",
+			expectedBody:        `{"status": 503, "method": "POST", "path": "http://example.com/response"}`,
+		},
+		{
+			name:           "invalid status",
+			method:         "GET",
+			path:           "/response?status=99",
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "body and template",
+			method:         "GET",
+			path:           "/response?body=a&template=b",
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "invalid header",
+			method:         "GET",
+			path:           "/response?header=invalid",
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "invalid template",
+			method:         "GET",
+			path:           "/response?template=%7B%7B.Missing%7D%7D",
+			expectedStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(tc.method, tc.path, strings.NewReader(tc.body))
+			rr := httptest.NewRecorder()
+			handler := newHTTPInfrabinHandler()
+			handler.ServeHTTP(rr, req)
+
+			if rr.Code != tc.expectedStatus {
+				t.Fatalf("handler returned wrong status code: got %v want %v: %s", rr.Code, tc.expectedStatus, rr.Body.String())
+			}
+			if tc.expectedStatus == http.StatusBadRequest {
+				return
+			}
+			if got := rr.Header().Get("Content-Type"); got != tc.expectedContentType {
+				t.Errorf("Content-Type header = %q, want %q", got, tc.expectedContentType)
+			}
+			for name, value := range tc.expectedHeaders {
+				if got := rr.Header().Get(name); got != value {
+					t.Errorf("%s header = %q, want %q", name, got, value)
+				}
+			}
+			if got := rr.Body.String(); got != tc.expectedBody {
+				t.Errorf("body = %q, want %q", got, tc.expectedBody)
+			}
+		})
+	}
+}
+
+func TestRedirectHandlers(t *testing.T) {
+	testCases := []struct {
+		name             string
+		method           string
+		path             string
+		host             string
+		headers          map[string]string
+		expectedStatus   int
+		expectedLocation string
+	}{
+		{
+			name:             "redirect is relative by default",
+			path:             "/redirect/3",
+			expectedStatus:   http.StatusFound,
+			expectedLocation: "/relative-redirect/2",
+		},
+		{
+			name:             "redirect absolute",
+			path:             "/redirect/3?absolute=true",
+			expectedStatus:   http.StatusFound,
+			expectedLocation: "http://example.com/absolute-redirect/2",
+		},
+		{
+			name:             "relative redirect keeps the status",
+			path:             "/relative-redirect/2?status=307",
+			expectedStatus:   http.StatusTemporaryRedirect,
+			expectedLocation: "/relative-redirect/1?status=307",
+		},
+		{
+			name:             "last relative redirect",
+			path:             "/relative-redirect/1?status=308",
+			expectedStatus:   http.StatusPermanentRedirect,
+			expectedLocation: "/anything",
+		},
+		{
+			name:             "absolute redirect uses the forwarded scheme and host",
+			path:             "/absolute-redirect/2?status=301",
+			headers:          map[string]string{"X-Forwarded-Proto": "https", "X-Forwarded-Host": "public.example.org"},
+			expectedStatus:   http.StatusMovedPermanently,
+			expectedLocation: "https://public.example.org/absolute-redirect/1?status=301",
+		},
+		{
+			name:             "last absolute redirect",
+			path:             "/absolute-redirect/1",
+			expectedStatus:   http.StatusFound,
+			expectedLocation: "http://example.com/anything",
+		},
+		{
+			name:             "redirect preserves POST",
+			method:           "POST",
+			path:             "/redirect/2?status=307",
+			expectedStatus:   http.StatusTemporaryRedirect,
+			expectedLocation: "/relative-redirect/1?status=307",
+		},
+		{
+			name:             "relative redirect preserves PUT",
+			method:           "PUT",
+			path:             "/relative-redirect/1?status=308",
+			expectedStatus:   http.StatusPermanentRedirect,
+			expectedLocation: "/anything",
+		},
+		{
+			name:             "absolute redirect preserves DELETE",
+			method:           "DELETE",
+			path:             "/absolute-redirect/2?status=307",
+			expectedStatus:   http.StatusTemporaryRedirect,
+			expectedLocation: "http://example.com/absolute-redirect/1?status=307",
+		},
+		{
+			name:           "zero redirects",
+			path:           "/redirect/0",
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "too many redirects",
+			path:           "/redirect/101",
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "invalid status",
+			path:           "/redirect/1?status=200",
+			expectedStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			method := tc.method
+			if method == "" {
+				method = "GET"
+			}
+			req := httptest.NewRequest(method, tc.path, strings.NewReader("payload"))
+			for key, value := range tc.headers {
+				req.Header.Set(key, value)
+			}
+			rr := httptest.NewRecorder()
+			// ListenAndServe applies the proxy headers before the handler
+			handler := handlers.ProxyHeaders(newHTTPInfrabinHandler())
+			handler.ServeHTTP(rr, req)
+
+			if rr.Code != tc.expectedStatus {
+				t.Fatalf("handler returned wrong status code: got %v want %v: %s", rr.Code, tc.expectedStatus, rr.Body.String())
+			}
+			if got := rr.Header().Get("Location"); got != tc.expectedLocation {
+				t.Errorf("Location header = %q, want %q", got, tc.expectedLocation)
+			}
+		})
+	}
+}
+
+func TestRedirectToHandler(t *testing.T) {
+	viper.Set("redirectAllowRegexp", `^https://([a-z]+\.)?example\.org/`)
+	defer viper.Set("redirectAllowRegexp", RedirectAllowRegexp)
+
+	testCases := []struct {
+		name             string
+		path             string
+		expectedStatus   int
+		expectedLocation string
+	}{
+		{
+			name:             "allowed target",
+			path:             "/redirect-to?url=https://www.example.org/path",
+			expectedStatus:   http.StatusFound,
+			expectedLocation: "https://www.example.org/path",
+		},
+		{
+			name:             "allowed target with status",
+			path:             "/redirect-to?url=https://example.org/&status=303",
+			expectedStatus:   http.StatusSeeOther,
+			expectedLocation: "https://example.org/",
+		},
+		{
+			name:           "blocked target",
+			path:           "/redirect-to?url=https://evil.example.com/",
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "missing url",
+			path:           "/redirect-to",
+			expectedStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", tc.path, nil)
+			rr := httptest.NewRecorder()
+			handler := newHTTPInfrabinHandler()
+			handler.ServeHTTP(rr, req)
+
+			if rr.Code != tc.expectedStatus {
+				t.Fatalf("handler returned wrong status code: got %v want %v: %s", rr.Code, tc.expectedStatus, rr.Body.String())
+			}
+			if got := rr.Header().Get("Location"); got != tc.expectedLocation {
+				t.Errorf("Location header = %q, want %q", got, tc.expectedLocation)
+			}
+		})
+	}
+}
+
+func TestCookiesHandlers(t *testing.T) {
+	testCases := []struct {
+		name               string
+		path               string
+		cookie             string
+		expectedStatus     int
+		expectedCookies    map[string]string
+		expectedSetCookies []string
+	}{
+		{
+			name:            "get",
+			path:            "/cookies",
+			cookie:          "session=abc; affinity=node-1",
+			expectedStatus:  http.StatusOK,
+			expectedCookies: map[string]string{"session": "abc", "affinity": "node-1"},
+		},
+		{
+			name:               "set",
+			path:               "/cookies/set?session=abc&affinity=node-1",
+			expectedStatus:     http.StatusOK,
+			expectedCookies:    map[string]string{},
+			expectedSetCookies: []string{"affinity=node-1", "session=abc"},
+		},
+		{
+			name:               "set with attributes",
+			path:               "/cookies/set?session=abc&domain=example.com&path=/app&max_age=60&secure=true&http_only=true&same_site=none",
+			cookie:             "other=1",
+			expectedStatus:     http.StatusOK,
+			expectedCookies:    map[string]string{"other": "1"},
+			expectedSetCookies: []string{"session=abc; Path=/app; Domain=example.com; Max-Age=60; HttpOnly; Secure; SameSite=None"},
+		},
+		{
+			name:               "delete",
+			path:               "/cookies/delete?session&path=/app",
+			cookie:             "session=abc",
+			expectedStatus:     http.StatusOK,
+			expectedCookies:    map[string]string{"session": "abc"},
+			expectedSetCookies: []string{"session=; Path=/app; Max-Age=0"},
+		},
+		{
+			name:           "invalid same site",
+			path:           "/cookies/set?session=abc&same_site=invalid",
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "invalid cookie name",
+			path:           "/cookies/set?bad%20name=abc",
+			expectedStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", tc.path, nil)
+			if tc.cookie != "" {
+				req.Header.Set("Cookie", tc.cookie)
+			}
+			rr := httptest.NewRecorder()
+			handler := newHTTPInfrabinHandler()
+			handler.ServeHTTP(rr, req)
+
+			if rr.Code != tc.expectedStatus {
+				t.Fatalf("handler returned wrong status code: got %v want %v: %s", rr.Code, tc.expectedStatus, rr.Body.String())
+			}
+			if tc.expectedStatus != http.StatusOK {
+				return
+			}
+			if diff := cmp.Diff(tc.expectedSetCookies, rr.Header().Values("Set-Cookie")); diff != "" {
+				t.Errorf("unexpected Set-Cookie headers (-want +got):\n%s", diff)
+			}
+			var got Response
+			if err := protojson.Unmarshal(rr.Body.Bytes(), &got); err != nil {
+				t.Fatalf("failed to parse response %v: %v", rr.Body.String(), err)
+			}
+			if got.Hostname == "" {
+				t.Errorf("expected the serving hostname in the response")
+			}
+			expected := &CookiesResponse{Cookies: tc.expectedCookies, SetCookies: tc.expectedSetCookies}
+			if diff := cmp.Diff(expected, got.Cookies, protocmp.Transform()); diff != "" {
+				t.Errorf("unexpected difference (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
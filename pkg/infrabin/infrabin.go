@@ -7,17 +7,20 @@ import (
 	"bytes"
 	"context"
 	"crypto/tls"
+	"errors"
 	"fmt"
 	"io"
+	"math/rand/v2"
 	"net"
 	"net/http"
 	"net/url"
 	"os"
 	"regexp"
+	"strconv"
 	"strings"
-	"sync/atomic"
 	"time"
 
+	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/health/grpc_health_v1"
 	"google.golang.org/grpc/metadata"
@@ -26,7 +29,6 @@ import (
 
 	"github.com/maruina/go-infrabin/internal/aws"
 	"github.com/maruina/go-infrabin/internal/helpers"
-	"github.com/mazen160/go-random"
 	"github.com/spf13/viper"
 )
 
@@ -34,9 +36,10 @@ import (
 // It must embed UnimplementedInfrabinServer for protogen-gen-go-grpc compatibility.
 type InfrabinService struct {
 	UnimplementedInfrabinServer
-	STSClient                 aws.STSClient
-	HealthService             HealthService
-	intermittentErrorsCounter atomic.Int32
+	STSClient            aws.STSClient
+	HealthService        HealthService
+	intermittentCounters intermittentCounters
+	failures             FailureToggles
 }
 
 // HealthService defines the interface for managing health check status.
@@ -71,11 +74,6 @@ func validateDNSServerAddress(dnsServer string) (string, error) {
 }
 
 func (s *InfrabinService) Root(ctx context.Context, _ *Empty) (*Response, error) {
-	fail := helpers.GetEnv("FAIL_ROOT_HANDLER", "")
-	if fail != "" {
-		return nil, status.Errorf(codes.Unavailable, "root handler is configured to fail via FAIL_ROOT_HANDLER=%s", fail)
-	}
-
 	hostname, err := os.Hostname()
 	if err != nil {
 		return nil, status.Errorf(codes.Internal, "cannot get hostname: %v", err)
@@ -97,7 +95,10 @@ func (s *InfrabinService) Root(ctx context.Context, _ *Empty) (*Response, error)
 
 func (s *InfrabinService) Delay(ctx context.Context, request *DelayRequest) (*Response, error) {
 	maxDelay := viper.GetDuration("maxDelay")
-	requestDuration := time.Duration(request.Duration) * time.Second
+	requestDuration, err := sampleDelay(request)
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid delay: %v", err)
+	}
 
 	duration := helpers.MinDuration(requestDuration, maxDelay)
 
@@ -107,7 +108,7 @@ func (s *InfrabinService) Delay(ctx context.Context, request *DelayRequest) (*Re
 
 	select {
 	case <-timer.C:
-		return &Response{Delay: int32(duration.Seconds())}, nil
+		return &Response{Delay: int32(duration.Seconds()), DelayDuration: duration.String()}, nil
 	case <-ctx.Done():
 		return nil, status.FromContextError(ctx.Err()).Err()
 	}
@@ -239,28 +240,61 @@ func (s *InfrabinService) AWSGetCallerIdentity(ctx context.Context, _ *Empty) (*
 	}, nil
 }
 
-func (s *InfrabinService) Intermittent(ctx context.Context, _ *Empty) (*Response, error) {
+func (s *InfrabinService) Intermittent(ctx context.Context, request *IntermittentRequest) (*Response, error) {
 	maxErrs := viper.GetInt32("intermittentErrors")
+	if request.N != nil {
+		maxErrs = *request.N
+	}
+	code := int(request.Code)
+	if code == 0 {
+		code = http.StatusServiceUnavailable
+	}
+	if code < http.StatusBadRequest || code > 599 {
+		return nil, status.Errorf(codes.InvalidArgument, "code %d must be between 400 and 599", code)
+	}
+	if err := validateIntermittentPattern(request.Pattern, int64(maxErrs), int64(request.M)); err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid pattern: %v", err)
+	}
 
-	counter := s.intermittentErrorsCounter.Add(1)
-	if counter <= maxErrs {
-		return nil, status.Errorf(codes.Unavailable, "%d errors left", maxErrs-counter+1)
+	// Each key has its own counter, so that concurrent clients using different keys do not interfere
+	counter := s.intermittentCounters.next(request.Key)
+	if intermittentFails(request.Pattern, int64(maxErrs), int64(request.M), counter) {
+		switch request.Pattern {
+		case "", IntermittentPatternFailFirst:
+			return nil, httpStatusError(ctx, code, "%d errors left", int64(maxErrs)-(counter-1)%(int64(maxErrs)+1))
+		default:
+			return nil, httpStatusError(ctx, code, "request %d failed by pattern %s", counter, request.Pattern)
+		}
 	}
 
-	// Use CompareAndSwap to atomically reset counter only if it's still at the value we read.
-	// This prevents race conditions where multiple goroutines might try to reset simultaneously.
-	// We intentionally ignore the boolean return value - if another goroutine already reset it, that's fine.
-	s.intermittentErrorsCounter.CompareAndSwap(counter, 0)
 	return &Response{
 		Intermittent: &IntermittentResponse{
 			IntermittentErrors: maxErrs,
+			Key:                request.Key,
+			Pattern:            request.Pattern,
+		},
+	}, nil
+}
+
+// ResetIntermittent resets the counter of an Intermittent key, so that its pattern starts over.
+func (s *InfrabinService) ResetIntermittent(ctx context.Context, request *IntermittentRequest) (*Response, error) {
+	s.intermittentCounters.reset(request.Key)
+	return &Response{
+		Intermittent: &IntermittentResponse{
+			Key: request.Key,
 		},
 	}, nil
 }
 
 func (s *InfrabinService) RandomData(ctx context.Context, request *RandomDataRequest) (*Response, error) {
-	response, err := random.Bytes(int(request.GetPath()))
-	if err != nil {
+	if err := validateBytesSize(int64(request.GetPath())); err != nil {
+		return nil, err
+	}
+	if request.GetPath() > MaxRandomDataSize {
+		return nil, status.Errorf(codes.InvalidArgument, "the number of bytes must be at most %d, the raw bytes are not limited", MaxRandomDataSize)
+	}
+	response := make([]byte, request.GetPath())
+	if _, err := io.ReadFull(randomReader(request.Seed), response); err != nil {
 		return nil, status.Errorf(codes.Internal, "failed to generate random data: %v", err)
 	}
 	return &Response{
@@ -356,6 +390,8 @@ const (
 	// MaxEgressResponseBodySize is the maximum response body size to read from egress HTTP/HTTPS requests.
 	// Limited to 1MB to prevent memory exhaustion from large responses.
 	MaxEgressResponseBodySize = 1024 * 1024
+	// MaxEgressBannerSize is the maximum response size to read from egress TCP connections.
+	MaxEgressBannerSize = 4 * 1024
 )
 
 // testHTTPConnection performs an HTTP/HTTPS connectivity test.
@@ -497,6 +533,118 @@ func (s *InfrabinService) testHTTPConnection(ctx context.Context, target, scheme
 	}, nil
 }
 
+// EgressTCP performs a TCP connectivity test, for services that do not speak HTTP.
+// Target format: "host:port@dns" where @dns is optional. Once connected, it sends request.Send
+// and reads the response until it matches request.Expect, if set.
+// Like testHTTPConnection, failures are returned in the response body with the timing information.
+func (s *InfrabinService) EgressTCP(ctx context.Context, request *EgressTCPRequest) (*EgressResponse, error) {
+	if request.Target == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "target must not be empty")
+	}
+
+	hostPort, dnsServer := parseTargetAndDNS(request.Target)
+	if _, _, err := net.SplitHostPort(hostPort); err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "target must be host:port: %v", err)
+	}
+	var expect *regexp.Regexp
+	if request.Expect != "" {
+		var err error
+		if expect, err = regexp.Compile(request.Expect); err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "invalid expect regexp: %v", err)
+		}
+	}
+
+	// Sending arbitrary bytes to any host:port is only allowed for the targets matching egressTCPAllowRegexp
+	if request.Send != "" {
+		exp := viper.GetString("egressTCPAllowRegexp")
+		r, err := regexp.Compile(exp)
+		if err != nil {
+			return nil, status.Errorf(codes.Internal, "Unable to compile %s regexp: %v", exp, err)
+		}
+		if !r.MatchString(hostPort) {
+			return nil, status.Errorf(codes.InvalidArgument, "Unable to send to the target %s as it is blocked by the regexp %s", hostPort, exp)
+		}
+	}
+
+	resolver, err := s.createDNSResolver(dnsServer)
+	if err != nil {
+		return &EgressResponse{
+			Success: false,
+			Error:   err.Error(),
+			Target:  hostPort,
+		}, nil
+	}
+
+	// The timeout covers the whole test: resolution, connection, payload and response
+	timeout := viper.GetDuration("egressTimeout")
+	dialer := net.Dialer{
+		Timeout:  timeout,
+		Resolver: resolver,
+	}
+	start := time.Now()
+	conn, err := dialer.DialContext(ctx, "tcp", hostPort)
+	connect := time.Since(start)
+
+	if err != nil {
+		return &EgressResponse{
+			Success:    false,
+			Error:      err.Error(),
+			Target:     hostPort,
+			DurationMs: connect.Milliseconds(),
+			ConnectMs:  connect.Milliseconds(),
+		}, nil
+	}
+	defer func() { _ = conn.Close() }()
+	if timeout > 0 {
+		_ = conn.SetDeadline(start.Add(timeout))
+	}
+
+	banner, err := exchangeTCP(conn, request.Send, expect)
+	response := &EgressResponse{
+		Target:        hostPort,
+		DurationMs:    time.Since(start).Milliseconds(),
+		ConnectMs:     connect.Milliseconds(),
+		LocalAddress:  conn.LocalAddr().String(),
+		RemoteAddress: conn.RemoteAddr().String(),
+		// Banners of binary protocols are not valid UTF-8, which JSON strings require
+		Banner: strings.ToValidUTF8(string(banner), "\uFFFD"),
+	}
+	if err != nil {
+		response.Error = err.Error()
+		return response, nil
+	}
+	response.Success = true
+	response.Message = fmt.Sprintf("Successfully connected to %s", hostPort)
+	return response, nil
+}
+
+// exchangeTCP sends the payload on conn if not empty, then reads the response until it matches expect,
+// up to MaxEgressBannerSize bytes. It returns the response read, nil if expect is nil.
+func exchangeTCP(conn net.Conn, send string, expect *regexp.Regexp) ([]byte, error) {
+	if send != "" {
+		if _, err := io.WriteString(conn, send); err != nil {
+			return nil, fmt.Errorf("failed to send the payload: %w", err)
+		}
+	}
+	if expect == nil {
+		return nil, nil
+	}
+
+	banner := make([]byte, MaxEgressBannerSize)
+	read := 0
+	for read < len(banner) {
+		n, err := conn.Read(banner[read:])
+		read += n
+		if expect.Match(banner[:read]) {
+			return banner[:read], nil
+		}
+		if err != nil {
+			return banner[:read], fmt.Errorf("response does not match %q: %w", expect, err)
+		}
+	}
+	return banner, fmt.Errorf("the first %d bytes of the response do not match %q", len(banner), expect)
+}
+
 // SetLivenessStatus controls the liveness probe status for the "liveness" service.
 // It updates the gRPC health check status that can be queried via grpc.health.v1.Health/Check.
 // Accepts "pass" to mark as healthy (SERVING), "fail" to mark as unhealthy (NOT_SERVING).
@@ -529,6 +677,42 @@ func (s *InfrabinService) SetReadinessStatus(ctx context.Context, req *SetHealth
 	}, nil
 }
 
+// SetFailure makes an RPC fail at runtime with codes.Unavailable, until it is set back to "off" or the ttl elapses.
+// Accepts "on" to make the RPC fail, "off" to restore it.
+func (s *InfrabinService) SetFailure(ctx context.Context, req *SetFailureRequest) (*Response, error) {
+	rpc, ok := infrabinMethodName(req.Rpc)
+	if !ok {
+		return nil, status.Errorf(codes.InvalidArgument, "unknown rpc: %s", req.Rpc)
+	}
+	if rpc == "SetFailure" {
+		return nil, status.Errorf(codes.InvalidArgument, "SetFailure cannot be configured to fail")
+	}
+	if req.State != "on" && req.State != "off" {
+		return nil, status.Errorf(codes.InvalidArgument, "state must be 'on' or 'off', got: %s", req.State)
+	}
+
+	var ttl time.Duration
+	if req.Ttl != "" {
+		var err error
+		if ttl, err = time.ParseDuration(req.Ttl); err != nil || ttl <= 0 {
+			return nil, status.Errorf(codes.InvalidArgument, "ttl must be a positive duration, got: %s", req.Ttl)
+		}
+	}
+
+	s.failures.Set(rpc, req.State == "on", ttl)
+
+	message := fmt.Sprintf("%s failure set to %s", rpc, req.State)
+	if ttl > 0 {
+		message += fmt.Sprintf(" for %s", ttl)
+	}
+	return &Response{Failure: message}, nil
+}
+
+// IsFailing returns true if the RPC is configured to fail via SetFailure.
+func (s *InfrabinService) IsFailing(rpc string) bool {
+	return s.failures.IsFailing(rpc)
+}
+
 // validateHealthStatus validates that the status is either "pass" or "fail".
 // Returns a gRPC InvalidArgument error if the status is invalid.
 func validateHealthStatus(statusValue string) error {
@@ -551,3 +735,240 @@ func parseHealthStatus(statusValue string) grpc_health_v1.HealthCheckResponse_Se
 		return grpc_health_v1.HealthCheckResponse_SERVING
 	}
 }
+
+// Status returns the requested status code, or one picked from a weighted list.
+// 2xx and 3xx codes return a successful response, 4xx and 5xx codes return the equivalent gRPC error.
+// The HTTP status code is sent in the HTTPCodeHeader header so that the gateway can return it as is.
+func (s *InfrabinService) Status(ctx context.Context, request *StatusRequest) (*Response, error) {
+	choices, err := parseWeightedCodes(request.Code)
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid status code %q: %v", request.Code, err)
+	}
+	code := pickWeightedCode(choices)
+
+	if code >= http.StatusBadRequest {
+		return nil, httpStatusError(ctx, code, "%d %s", code, http.StatusText(code))
+	}
+	setHTTPCode(ctx, code)
+	return &Response{StatusCode: int32(code)}, nil
+}
+
+// Stream sends request.Count messages at the requested interval, the first one immediately.
+func (s *InfrabinService) Stream(request *StreamRequest, stream grpc.ServerStreamingServer[Response]) error {
+	interval, err := parseStreamInterval(int64(request.Count), request.Interval)
+	if err != nil {
+		return err
+	}
+
+	hostname, err := os.Hostname()
+	if err != nil {
+		return status.Errorf(codes.Internal, "cannot get hostname: %v", err)
+	}
+
+	ctx := stream.Context()
+	for sequence := int32(1); sequence <= request.Count; sequence++ {
+		if sequence > 1 {
+			// Respect context cancellation between messages
+			select {
+			case <-time.After(interval):
+			case <-ctx.Done():
+				return status.FromContextError(ctx.Err()).Err()
+			}
+		}
+		response := &Response{
+			Hostname: hostname,
+			Stream:   &StreamResponse{Sequence: sequence, Count: request.Count},
+		}
+		if err := stream.Send(response); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Echo echoes each message back with the stream counters, and sends pings until the stream ends.
+// Only this goroutine sends on the stream, the messages are received by a separate goroutine.
+func (s *InfrabinService) Echo(stream grpc.BidiStreamingServer[EchoRequest, EchoResponse]) error {
+	start := time.Now()
+	hostname, err := os.Hostname()
+	if err != nil {
+		return status.Errorf(codes.Internal, "cannot get hostname: %v", err)
+	}
+
+	ctx := stream.Context()
+	requests := make(chan *EchoRequest)
+	recvErr := make(chan error, 1)
+	go func() {
+		for {
+			request, err := stream.Recv()
+			if err != nil {
+				recvErr <- err
+				return
+			}
+			select {
+			case requests <- request:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	// The pings and lifetime channels stay nil until configured by the first message
+	var pings, lifetime <-chan time.Time
+	var received, sent int64
+	for {
+		response := &EchoResponse{Hostname: hostname}
+		select {
+		case request := <-requests:
+			received++
+			response.ReceivedAt = time.Now().Format(time.RFC3339Nano)
+			response.Message = request.Message
+			if received == 1 {
+				if request.PingInterval != "" {
+					interval, err := parseDelayDuration(request.PingInterval)
+					if err != nil {
+						return status.Errorf(codes.InvalidArgument, "invalid ping_interval: %v", err)
+					}
+					if interval < MinStreamInterval {
+						return status.Errorf(codes.InvalidArgument, "ping_interval must be at least %s", MinStreamInterval)
+					}
+					ticker := time.NewTicker(interval)
+					defer ticker.Stop()
+					pings = ticker.C
+				}
+				if request.MaxLifetime != "" {
+					maxLifetime, err := parseDelayDuration(request.MaxLifetime)
+					if err != nil {
+						return status.Errorf(codes.InvalidArgument, "invalid max_lifetime: %v", err)
+					}
+					timer := time.NewTimer(maxLifetime - time.Since(start))
+					defer timer.Stop()
+					lifetime = timer.C
+				}
+			}
+		case <-pings:
+			response.Ping = true
+		case <-lifetime:
+			// End the stream with an OK status
+			return nil
+		case err := <-recvErr:
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		case <-ctx.Done():
+			return status.FromContextError(ctx.Err()).Err()
+		}
+
+		sent++
+		response.Received = received
+		response.Sent = sent
+		if err := stream.Send(response); err != nil {
+			return err
+		}
+	}
+}
+
+// setHTTPCode sets the HTTPCodeHeader header, so that the gateway returns the HTTP status code as is.
+func setHTTPCode(ctx context.Context, code int) {
+	// SetHeader fails when there is no transport stream in the context (e.g. direct calls in tests),
+	// in which case there is no gateway to forward the HTTP status code to.
+	_ = grpc.SetHeader(ctx, metadata.Pairs(HTTPCodeHeader, strconv.Itoa(code)))
+}
+
+// httpStatusError returns an error with the gRPC status code equivalent to the HTTP status code,
+// and sets the HTTPCodeHeader header so that the gateway returns the HTTP status code as is.
+func httpStatusError(ctx context.Context, code int, format string, a ...any) error {
+	setHTTPCode(ctx, code)
+	return status.Errorf(grpcCodeFromHTTPStatus(code), format, a...)
+}
+
+// weightedCode is an HTTP status code with its relative weight.
+type weightedCode struct {
+	code   int
+	weight int
+}
+
+// parseWeightedCodes parses a status code or a comma-separated list of "code:weight" pairs.
+// The weight is optional and defaults to 1. Codes must be between 200 and 599.
+func parseWeightedCodes(value string) ([]weightedCode, error) {
+	var (
+		result []weightedCode
+		total  int
+	)
+	for _, item := range strings.Split(value, ",") {
+		codeStr, weightStr, hasWeight := strings.Cut(strings.TrimSpace(item), ":")
+		code, err := strconv.Atoi(codeStr)
+		if err != nil {
+			return nil, fmt.Errorf("code %q is not a number", codeStr)
+		}
+		if code < http.StatusOK || code > 599 {
+			return nil, fmt.Errorf("code %d must be between 200 and 599", code)
+		}
+		weight := 1
+		if hasWeight {
+			if weight, err = strconv.Atoi(weightStr); err != nil || weight < 0 {
+				return nil, fmt.Errorf("weight %q must be a non-negative number", weightStr)
+			}
+		}
+		total += weight
+		result = append(result, weightedCode{code: code, weight: weight})
+	}
+	if total == 0 {
+		return nil, fmt.Errorf("at least one weight must be greater than zero")
+	}
+	return result, nil
+}
+
+// pickWeightedCode picks a random code with probability proportional to its weight.
+// The total weight must be greater than zero.
+func pickWeightedCode(choices []weightedCode) int {
+	var total int
+	for _, c := range choices {
+		total += c.weight
+	}
+	n := rand.IntN(total)
+	for _, c := range choices {
+		if n < c.weight {
+			return c.code
+		}
+		n -= c.weight
+	}
+	return choices[len(choices)-1].code
+}
+
+// grpcCodeFromHTTPStatus maps an HTTP error status code to the closest gRPC status code.
+// It is the inverse of runtime.HTTPStatusFromCode, with 502 and 503 both mapping to Unavailable,
+// and the statuses it does not produce, e.g. 413, mapping to the code of the closest one.
+func grpcCodeFromHTTPStatus(code int) codes.Code {
+	switch code {
+	case http.StatusBadRequest:
+		return codes.InvalidArgument
+	case http.StatusUnauthorized:
+		return codes.Unauthenticated
+	case http.StatusForbidden:
+		return codes.PermissionDenied
+	case http.StatusNotFound:
+		return codes.NotFound
+	case http.StatusConflict:
+		return codes.Aborted
+	case http.StatusPreconditionFailed:
+		return codes.FailedPrecondition
+	case http.StatusRequestedRangeNotSatisfiable:
+		return codes.OutOfRange
+	case http.StatusTooManyRequests, http.StatusRequestEntityTooLarge:
+		return codes.ResourceExhausted
+	case 499:
+		return codes.Canceled
+	case http.StatusNotImplemented:
+		return codes.Unimplemented
+	case http.StatusBadGateway, http.StatusServiceUnavailable:
+		return codes.Unavailable
+	case http.StatusGatewayTimeout, http.StatusRequestTimeout:
+		return codes.DeadlineExceeded
+	case http.StatusInternalServerError:
+		return codes.Internal
+	default:
+		return codes.Unknown
+	}
+}
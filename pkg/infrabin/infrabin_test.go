@@ -2,13 +2,19 @@ package infrabin
 
 import (
 	"context"
+	"io"
+	"os"
+	"reflect"
 	"strings"
 	"testing"
 	"time"
 
 	"github.com/spf13/viper"
+	"google.golang.org/genproto/googleapis/api/httpbody"
+	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/status"
 )
 
@@ -333,7 +339,7 @@ func TestDelayContextCancellation(t *testing.T) {
 	defer cancel()
 
 	// Request a delay longer than the context timeout
-	req := &DelayRequest{Duration: 5}
+	req := &DelayRequest{Delay: "5s"}
 
 	start := time.Now()
 	resp, err := service.Delay(ctx, req)
@@ -360,7 +366,322 @@ func TestDelayContextCancellation(t *testing.T) {
 	}
 }
 
+func TestStreamContextCancellation(t *testing.T) {
+	viper.Set("maxDelay", 10*time.Second)
+	defer viper.Reset()
+
+	service := &InfrabinService{}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	stream := newInProcessStream[*Response](ctx)
+
+	start := time.Now()
+	go func() {
+		stream.finish(service.Stream(&StreamRequest{Count: 2, Interval: "5s"}, stream))
+	}()
+
+	if _, err := stream.Recv(); err != nil {
+		t.Fatalf("Recv() returned unexpected error for the first message: %v", err)
+	}
+	_, err := stream.Recv()
+	if status.Code(err) != codes.DeadlineExceeded {
+		t.Errorf("Recv() error code = %v, want %v", status.Code(err), codes.DeadlineExceeded)
+	}
+	if elapsed := time.Since(start); elapsed > 1*time.Second {
+		t.Errorf("Stream() took too long to cancel: %v, should be less than 1s", elapsed)
+	}
+}
+
+// fakeEchoStream is a fake Echo stream, the requests are sent by the test and the responses received by the test.
+type fakeEchoStream struct {
+	grpc.ServerStream
+	ctx       context.Context
+	requests  chan *EchoRequest
+	responses chan *EchoResponse
+}
+
+func newFakeEchoStream(ctx context.Context) *fakeEchoStream {
+	return &fakeEchoStream{
+		ctx:       ctx,
+		requests:  make(chan *EchoRequest),
+		responses: make(chan *EchoResponse, 10),
+	}
+}
+
+func (f *fakeEchoStream) Context() context.Context { return f.ctx }
+
+func (f *fakeEchoStream) Send(response *EchoResponse) error {
+	f.responses <- response
+	return nil
+}
+
+func (f *fakeEchoStream) Recv() (*EchoRequest, error) {
+	request, ok := <-f.requests
+	if !ok {
+		return nil, io.EOF
+	}
+	return request, nil
+}
+
+func TestEcho(t *testing.T) {
+	service := &InfrabinService{}
+	stream := newFakeEchoStream(context.Background())
+
+	done := make(chan error, 1)
+	go func() {
+		done <- service.Echo(stream)
+	}()
+
+	stream.requests <- &EchoRequest{Message: "hello", PingInterval: "20ms"}
+	response := <-stream.responses
+	if response.Message != "hello" || response.Received != 1 || response.Sent != 1 || response.Ping {
+		t.Errorf("Echo() first response = %v, want hello echoed with 1 received and 1 sent", response)
+	}
+	if _, err := time.Parse(time.RFC3339Nano, response.ReceivedAt); err != nil {
+		t.Errorf("Echo() received_at %q is not RFC 3339: %v", response.ReceivedAt, err)
+	}
+	if hostname, _ := os.Hostname(); response.Hostname != hostname {
+		t.Errorf("Echo() hostname = %v, want %v", response.Hostname, hostname)
+	}
+
+	response = <-stream.responses
+	if !response.Ping || response.Received != 1 || response.Sent != 2 {
+		t.Errorf("Echo() second response = %v, want a ping with 1 received and 2 sent", response)
+	}
+
+	close(stream.requests)
+	if err := <-done; err != nil {
+		t.Errorf("Echo() returned unexpected error when the client closed the stream: %v", err)
+	}
+}
+
+func TestEchoMaxLifetime(t *testing.T) {
+	service := &InfrabinService{}
+	stream := newFakeEchoStream(context.Background())
+
+	done := make(chan error, 1)
+	go func() {
+		done <- service.Echo(stream)
+	}()
+
+	start := time.Now()
+	stream.requests <- &EchoRequest{Message: "hello", MaxLifetime: "50ms"}
+	<-stream.responses
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("Echo() returned unexpected error at the end of its lifetime: %v", err)
+		}
+		if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+			t.Errorf("Echo() ended after %v, want at least 50ms", elapsed)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("Echo() did not end after its max lifetime")
+	}
+}
+
+func TestEchoInvalidPingInterval(t *testing.T) {
+	for _, interval := range []string{"0", "1ns", "invalid"} {
+		t.Run(interval, func(t *testing.T) {
+			service := &InfrabinService{}
+			stream := newFakeEchoStream(context.Background())
+
+			done := make(chan error, 1)
+			go func() {
+				done <- service.Echo(stream)
+			}()
+
+			stream.requests <- &EchoRequest{PingInterval: interval}
+			if err := <-done; status.Code(err) != codes.InvalidArgument {
+				t.Errorf("Echo() error code = %v, want %v", status.Code(err), codes.InvalidArgument)
+			}
+		})
+	}
+}
+
+func TestAnythingGRPC(t *testing.T) {
+	service := &InfrabinService{}
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(":authority", "localhost:50051", "x-test", "value"))
+
+	resp, err := service.Anything(ctx, &AnythingRequest{
+		Body: &httpbody.HttpBody{ContentType: "application/json", Data: []byte(`[1,2]`)},
+	})
+	if err != nil {
+		t.Fatalf("Anything() returned unexpected error: %v", err)
+	}
+	got := resp.Anything
+	if got.Method != "POST" || got.Url != "grpc://localhost:50051/infrabin.Infrabin/Anything" || got.Headers["x-test"] != "value" {
+		t.Errorf("Anything() = %v, want the gRPC method, URL and metadata", got)
+	}
+	if got.Data != "[1,2]" || len(got.Json.GetListValue().GetValues()) != 2 {
+		t.Errorf("Anything() = %v, want the raw and parsed JSON body", got)
+	}
+}
+
+func TestSetCookiesGRPC(t *testing.T) {
+	service := &InfrabinService{}
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("cookie", "session=abc; affinity=node-1"))
+
+	resp, err := service.SetCookies(ctx, &CookiesRequest{Cookies: map[string]string{"session": "def"}, SameSite: "Strict"})
+	if err != nil {
+		t.Fatalf("SetCookies() returned unexpected error: %v", err)
+	}
+	if want := map[string]string{"session": "abc", "affinity": "node-1"}; !reflect.DeepEqual(resp.Cookies.Cookies, want) {
+		t.Errorf("SetCookies() cookies = %v, want %v", resp.Cookies.Cookies, want)
+	}
+	if want := []string{"session=def; SameSite=Strict"}; !reflect.DeepEqual(resp.Cookies.SetCookies, want) {
+		t.Errorf("SetCookies() set_cookies = %v, want %v", resp.Cookies.SetCookies, want)
+	}
+}
+
 // stringPtr is a helper function to create string pointers for tests
 func stringPtr(s string) *string {
 	return &s
 }
+
+func TestStatus(t *testing.T) {
+	tests := []struct {
+		name       string
+		code       string
+		wantErr    bool
+		wantCode   codes.Code
+		wantStatus int32
+	}{
+		{
+			name:       "success code returns response",
+			code:       "200",
+			wantStatus: 200,
+		},
+		{
+			name:       "redirect code returns response",
+			code:       "307",
+			wantStatus: 307,
+		},
+		{
+			name:     "too many requests returns ResourceExhausted",
+			code:     "429",
+			wantErr:  true,
+			wantCode: codes.ResourceExhausted,
+		},
+		{
+			name:     "gateway timeout returns DeadlineExceeded",
+			code:     "504",
+			wantErr:  true,
+			wantCode: codes.DeadlineExceeded,
+		},
+		{
+			name:     "unmapped code returns Unknown",
+			code:     "418",
+			wantErr:  true,
+			wantCode: codes.Unknown,
+		},
+		{
+			name:     "invalid code returns InvalidArgument",
+			code:     "600",
+			wantErr:  true,
+			wantCode: codes.InvalidArgument,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			service := &InfrabinService{}
+			resp, err := service.Status(context.Background(), &StatusRequest{Code: tt.code})
+
+			if tt.wantErr {
+				if status.Code(err) != tt.wantCode {
+					t.Errorf("Status() error code = %v, want %v", status.Code(err), tt.wantCode)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("Status() returned unexpected error: %v", err)
+			}
+			if resp.StatusCode != tt.wantStatus {
+				t.Errorf("Status() status_code = %v, want %v", resp.StatusCode, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestParseWeightedCodes(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		want    []weightedCode
+		wantErr bool
+	}{
+		{
+			name:  "single code defaults to weight 1",
+			value: "503",
+			want:  []weightedCode{{code: 503, weight: 1}},
+		},
+		{
+			name:  "weighted list",
+			value: "200:90, 503:10",
+			want:  []weightedCode{{code: 200, weight: 90}, {code: 503, weight: 10}},
+		},
+		{
+			name:  "mixed weighted and unweighted",
+			value: "200,502:0",
+			want:  []weightedCode{{code: 200, weight: 1}, {code: 502, weight: 0}},
+		},
+		{
+			name:    "not a number",
+			value:   "abc",
+			wantErr: true,
+		},
+		{
+			name:    "informational code",
+			value:   "100",
+			wantErr: true,
+		},
+		{
+			name:    "negative weight",
+			value:   "200:-1",
+			wantErr: true,
+		},
+		{
+			name:    "all weights zero",
+			value:   "200:0,503:0",
+			wantErr: true,
+		},
+		{
+			name:    "empty string",
+			value:   "",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			got, err := parseWeightedCodes(tt.value)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("parseWeightedCodes(%q) expected error but got none", tt.value)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseWeightedCodes(%q) returned unexpected error: %v", tt.value, err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseWeightedCodes(%q) = %v, want %v", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPickWeightedCode(t *testing.T) {
+	choices := []weightedCode{{code: 200, weight: 0}, {code: 503, weight: 1}, {code: 504, weight: 0}}
+	for range 100 {
+		if got := pickWeightedCode(choices); got != 503 {
+			t.Fatalf("pickWeightedCode() = %d, want 503", got)
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package infrabin
+
+import (
+	"fmt"
+	"math"
+	"sync"
+)
+
+// Failure patterns supported by the Intermittent endpoint
+const (
+	IntermittentPatternFailFirst = "fail-first"
+	IntermittentPatternFailNOfM  = "fail-n-of-m"
+	IntermittentPatternFailEvery = "fail-every"
+	IntermittentPatternFailAfter = "fail-after"
+)
+
+// MaxIntermittentKeys is the maximum number of Intermittent keys with a counter.
+// Once reached, the counter of the least recently used key is dropped for a new key.
+const MaxIntermittentKeys = 10000
+
+// intermittentCounters holds an independent request counter per Intermittent key.
+// The zero value is ready to use.
+type intermittentCounters struct {
+	mu       sync.Mutex
+	counters map[string]*intermittentCounter
+	// requests orders the uses of the counters
+	requests uint64
+}
+
+// intermittentCounter is the request counter of an Intermittent key
+type intermittentCounter struct {
+	count int64
+	// lastUsed is the value of intermittentCounters.requests when the counter was last used
+	lastUsed uint64
+}
+
+// next increments the counter of the key and returns the new value, starting at 1
+func (c *intermittentCounters) next(key string) int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	counter, ok := c.counters[key]
+	if !ok {
+		if c.counters == nil {
+			c.counters = make(map[string]*intermittentCounter)
+		}
+		if len(c.counters) >= MaxIntermittentKeys {
+			c.evictLeastRecentlyUsed()
+		}
+		counter = &intermittentCounter{}
+		c.counters[key] = counter
+	}
+	c.requests++
+	counter.count++
+	counter.lastUsed = c.requests
+	return counter.count
+}
+
+// evictLeastRecentlyUsed deletes the counter of the least recently used key. c.mu must be held.
+func (c *intermittentCounters) evictLeastRecentlyUsed() {
+	var oldestKey string
+	oldest := uint64(math.MaxUint64)
+	for key, counter := range c.counters {
+		if counter.lastUsed < oldest {
+			oldestKey, oldest = key, counter.lastUsed
+		}
+	}
+	delete(c.counters, oldestKey)
+}
+
+// reset resets the counter of the key
+func (c *intermittentCounters) reset(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.counters, key)
+}
+
+// validateIntermittentPattern validates the pattern and its parameters.
+func validateIntermittentPattern(pattern string, n, m int64) error {
+	if n < 0 {
+		return fmt.Errorf("n must not be negative")
+	}
+	switch pattern {
+	case "", IntermittentPatternFailFirst, IntermittentPatternFailAfter:
+		return nil
+	case IntermittentPatternFailNOfM:
+		if m < 1 || m < n {
+			return fmt.Errorf("m must be greater than zero and greater than or equal to n")
+		}
+		return nil
+	case IntermittentPatternFailEvery:
+		if n < 1 {
+			return fmt.Errorf("n must be greater than zero")
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown pattern %q", pattern)
+	}
+}
+
+// intermittentFails returns true if the count-th request, starting at 1, fails with the pattern.
+// The pattern must have been validated by validateIntermittentPattern.
+func intermittentFails(pattern string, n, m, count int64) bool {
+	switch pattern {
+	case IntermittentPatternFailNOfM:
+		return (count-1)%m < n
+	case IntermittentPatternFailEvery:
+		return count%n == 0
+	case IntermittentPatternFailAfter:
+		return count > n
+	default:
+		return (count-1)%(n+1) < n
+	}
+}
@@ -0,0 +1,125 @@
+package infrabin
+
+import (
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+func TestIntermittentFails(t *testing.T) {
+	testCases := []struct {
+		name     string
+		pattern  string
+		n        int64
+		m        int64
+		expected []bool
+	}{
+		{
+			name:     "fail first",
+			pattern:  IntermittentPatternFailFirst,
+			n:        2,
+			expected: []bool{true, true, false, true, true, false},
+		},
+		{
+			name:     "default pattern is fail first",
+			n:        1,
+			expected: []bool{true, false, true, false},
+		},
+		{
+			name:     "fail n of m",
+			pattern:  IntermittentPatternFailNOfM,
+			n:        1,
+			m:        3,
+			expected: []bool{true, false, false, true, false, false},
+		},
+		{
+			name:     "fail every",
+			pattern:  IntermittentPatternFailEvery,
+			n:        3,
+			expected: []bool{false, false, true, false, false, true},
+		},
+		{
+			name:     "fail after",
+			pattern:  IntermittentPatternFailAfter,
+			n:        2,
+			expected: []bool{false, false, true, true, true, true},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if err := validateIntermittentPattern(tc.pattern, tc.n, tc.m); err != nil {
+				t.Fatalf("validateIntermittentPattern() returned unexpected error: %v", err)
+			}
+			got := make([]bool, len(tc.expected))
+			for i := range got {
+				got[i] = intermittentFails(tc.pattern, tc.n, tc.m, int64(i+1))
+			}
+			if !reflect.DeepEqual(got, tc.expected) {
+				t.Errorf("intermittentFails() = %v, want %v", got, tc.expected)
+			}
+		})
+	}
+}
+
+func TestValidateIntermittentPatternInvalid(t *testing.T) {
+	testCases := []struct {
+		name    string
+		pattern string
+		n       int64
+		m       int64
+	}{
+		{name: "negative n", pattern: IntermittentPatternFailFirst, n: -1},
+		{name: "n greater than m", pattern: IntermittentPatternFailNOfM, n: 3, m: 2},
+		{name: "zero m", pattern: IntermittentPatternFailNOfM, n: 0, m: 0},
+		{name: "fail every zero", pattern: IntermittentPatternFailEvery, n: 0},
+		{name: "unknown pattern", pattern: "fail-sometimes", n: 1},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if err := validateIntermittentPattern(tc.pattern, tc.n, tc.m); err == nil {
+				t.Errorf("validateIntermittentPattern() expected error but got none")
+			}
+		})
+	}
+}
+
+func TestIntermittentCounters(t *testing.T) {
+	var counters intermittentCounters
+
+	if got := counters.next("a"); got != 1 {
+		t.Errorf("next(a) = %d, want 1", got)
+	}
+	if got := counters.next("a"); got != 2 {
+		t.Errorf("next(a) = %d, want 2", got)
+	}
+	if got := counters.next("b"); got != 1 {
+		t.Errorf("next(b) = %d, want 1", got)
+	}
+	counters.reset("a")
+	if got := counters.next("a"); got != 1 {
+		t.Errorf("next(a) after reset = %d, want 1", got)
+	}
+}
+
+func TestIntermittentCountersMaxKeys(t *testing.T) {
+	var counters intermittentCounters
+
+	counters.next("oldest")
+	for i := 1; i < MaxIntermittentKeys; i++ {
+		counters.next(strconv.Itoa(i))
+	}
+	counters.next("oldest")
+	counters.next("new")
+
+	if len(counters.counters) != MaxIntermittentKeys {
+		t.Errorf("counters has %d keys, want %d", len(counters.counters), MaxIntermittentKeys)
+	}
+	if _, ok := counters.counters["1"]; ok {
+		t.Errorf("the least recently used key was not evicted")
+	}
+	if got := counters.next("oldest"); got != 3 {
+		t.Errorf("next(oldest) = %d, want 3", got)
+	}
+}
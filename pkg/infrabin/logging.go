@@ -1,17 +1,18 @@
 package infrabin
 
 import (
+	"context"
 	"fmt"
 	"io"
-	"net"
 	"net/http"
-	"strings"
 
 	"github.com/gorilla/handlers"
 )
 
-// RequestLoggingFormatter extends Apache Combined Log Format with proper sourceIP handling
-// Format: sourceIP - remoteUser [timestamp] "method path protocol" statusCode size "referer" "userAgent"
+// RequestLoggingFormatter extends Apache Combined Log Format with proper sourceIP handling,
+// trusting the proxy headers only from the --trusted-proxies
+// and the marshaler of the gateway responses
+// Format: sourceIP - remoteUser [timestamp] "method path protocol" statusCode size "referer" "userAgent" "marshaler"
 func RequestLoggingFormatter(writer io.Writer, params handlers.LogFormatterParams) {
 	sourceIP := getSourceIP(params.Request)
 
@@ -33,8 +34,14 @@ func RequestLoggingFormatter(writer io.Writer, params handlers.LogFormatterParam
 		userAgent = "-"
 	}
 
-	// Apache Combined Log Format with sourceIP instead of RemoteAddr
-	_, _ = fmt.Fprintf(writer, "%s - %s [%s] \"%s %s %s\" %d %d \"%s\" \"%s\"\n",
+	// Get the marshaler of the gateway response, default to "-"
+	marshaler := "-"
+	if fields, ok := params.Request.Context().Value(accessLogKey{}).(*accessLogFields); ok && fields.marshaler != "" {
+		marshaler = fields.marshaler
+	}
+
+	// Apache Combined Log Format with sourceIP instead of RemoteAddr, and the marshaler
+	_, _ = fmt.Fprintf(writer, "%s - %s [%s] \"%s %s %s\" %d %d \"%s\" \"%s\" \"%s\"\n",
 		sourceIP,
 		username,
 		params.TimeStamp.Format("02/Jan/2006:15:04:05 -0700"),
@@ -45,29 +52,29 @@ func RequestLoggingFormatter(writer io.Writer, params handlers.LogFormatterParam
 		params.Size,
 		referer,
 		userAgent,
+		marshaler,
 	)
 }
 
-// getSourceIP extracts the source IP from the request, considering proxy headers
-func getSourceIP(r *http.Request) string {
-	// Check X-Real-IP header first
-	if realIP := r.Header.Get("X-Real-IP"); realIP != "" {
-		return realIP
-	}
+// accessLogKey is the context key of the accessLogFields of the request
+type accessLogKey struct{}
 
-	// Check X-Forwarded-For header (may contain multiple IPs, take the first)
-	if forwardedFor := r.Header.Get("X-Forwarded-For"); forwardedFor != "" {
-		// Split by comma and take the first IP
-		if idx := strings.Index(forwardedFor, ","); idx != -1 {
-			return strings.TrimSpace(forwardedFor[:idx])
-		}
-		return forwardedFor
-	}
+// accessLogFields are the fields of the access log set by the handlers
+type accessLogFields struct {
+	marshaler string
+}
 
-	// Fall back to RemoteAddr
-	if ip, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
-		return ip
-	}
+// withAccessLogFields stores empty accessLogFields in the request context, for the handlers to fill in.
+// It must wrap the logging handler, so that the formatter sees them.
+func withAccessLogFields(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), accessLogKey{}, &accessLogFields{})))
+	})
+}
 
-	return r.RemoteAddr
+// setAccessLogMarshaler sets the marshaler in the access log of the request, if any
+func setAccessLogMarshaler(ctx context.Context, name string) {
+	if fields, ok := ctx.Value(accessLogKey{}).(*accessLogFields); ok {
+		fields.marshaler = name
+	}
 }
@@ -0,0 +1,259 @@
+package infrabin
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"go.yaml.in/yaml/v3"
+	"google.golang.org/genproto/googleapis/api/httpbody"
+	"google.golang.org/protobuf/proto"
+)
+
+// MIME types of the response formats selected by the Accept header, in addition to JSON
+const (
+	MIMEProtobuf = "application/x-protobuf"
+	MIMEYAML     = "application/yaml"
+	MIMEText     = "text/plain"
+)
+
+// protoMarshaler is the gateway binary protobuf marshaler with the application/x-protobuf content type
+type protoMarshaler struct {
+	runtime.ProtoMarshaller
+}
+
+func (*protoMarshaler) ContentType(_ any) string {
+	return MIMEProtobuf
+}
+
+// yamlMarshaler marshals the messages as YAML documents, converted from their JSON representation.
+// YAML request bodies are converted to JSON before being unmarshaled.
+type yamlMarshaler struct {
+	*runtime.JSONPb
+}
+
+func (*yamlMarshaler) ContentType(_ any) string {
+	return MIMEYAML
+}
+
+func (m *yamlMarshaler) Marshal(v any) ([]byte, error) {
+	data, err := m.JSONPb.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	// JSON is valid YAML: parse it to keep the order of the fields, then reset the flow style of the nodes
+	var node yaml.Node
+	if err := yaml.Unmarshal(data, &node); err != nil {
+		return nil, err
+	}
+	resetYAMLStyle(&node)
+	data, err = yaml.Marshal(&node)
+	if err != nil {
+		return nil, err
+	}
+	// Start every message as a document, so that the streamed messages are a valid YAML stream
+	return append([]byte("---\n"), data...), nil
+}
+
+func (m *yamlMarshaler) Unmarshal(data []byte, v any) error {
+	var value any
+	if err := yaml.Unmarshal(data, &value); err != nil {
+		return err
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	return m.JSONPb.Unmarshal(data, v)
+}
+
+func (m *yamlMarshaler) NewDecoder(r io.Reader) runtime.Decoder {
+	return runtime.DecoderFunc(func(v any) error {
+		data, err := io.ReadAll(r)
+		if err != nil {
+			return err
+		}
+		return m.Unmarshal(data, v)
+	})
+}
+
+func (m *yamlMarshaler) NewEncoder(w io.Writer) runtime.Encoder {
+	return runtime.EncoderFunc(func(v any) error {
+		data, err := m.Marshal(v)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(data)
+		return err
+	})
+}
+
+// resetYAMLStyle resets the style of the node and its children, to marshal them in block style
+func resetYAMLStyle(node *yaml.Node) {
+	node.Style = 0
+	for _, child := range node.Content {
+		resetYAMLStyle(child)
+	}
+}
+
+// textMarshaler marshals the messages as sorted key=value lines, flattened from their JSON representation,
+// e.g. "ip.client_ip=192.0.2.1", so that shell scripts can consume them without a JSON parser.
+// Request bodies are unmarshaled as JSON.
+type textMarshaler struct {
+	*runtime.JSONPb
+}
+
+func (*textMarshaler) ContentType(_ any) string {
+	return MIMEText + "; charset=utf-8"
+}
+
+func (m *textMarshaler) Marshal(v any) ([]byte, error) {
+	data, err := m.JSONPb.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var value any
+	if err := decoder.Decode(&value); err != nil {
+		return nil, err
+	}
+
+	var lines []string
+	flattenText("", value, &lines)
+	slices.Sort(lines)
+	var buf bytes.Buffer
+	for _, line := range lines {
+		buf.WriteString(line)
+		buf.WriteByte('\n')
+	}
+	return buf.Bytes(), nil
+}
+
+func (m *textMarshaler) NewEncoder(w io.Writer) runtime.Encoder {
+	return runtime.EncoderFunc(func(v any) error {
+		data, err := m.Marshal(v)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(data)
+		return err
+	})
+}
+
+// flattenText appends the key=value lines of value to lines, joining the keys of nested values with dots
+func flattenText(key string, value any, lines *[]string) {
+	switch v := value.(type) {
+	case map[string]any:
+		for name, child := range v {
+			flattenText(joinTextKey(key, name), child, lines)
+		}
+	case []any:
+		for i, child := range v {
+			flattenText(joinTextKey(key, strconv.Itoa(i)), child, lines)
+		}
+	case string:
+		if strings.ContainsAny(v, " \t\r\n\"'\\") {
+			v = strconv.Quote(v)
+		}
+		*lines = append(*lines, key+"="+v)
+	case nil:
+		*lines = append(*lines, key+"=")
+	default:
+		*lines = append(*lines, fmt.Sprintf("%s=%v", key, v))
+	}
+}
+
+func joinTextKey(prefix string, name string) string {
+	if prefix == "" {
+		return name
+	}
+	return prefix + "." + name
+}
+
+// responseFormats are the names, for the access log, of the response formats by media type
+var responseFormats = map[string]string{
+	"application/json": "json",
+	MIMEProtobuf:       "protobuf",
+	MIMEYAML:           "yaml",
+	MIMEText:           "text",
+}
+
+// acceptRange is a media range of an Accept header, with its q-value
+type acceptRange struct {
+	mediaType string
+	q         float64
+}
+
+// parseAccept returns the media ranges of the Accept header values in order, without their parameters
+// other than the q-value. Invalid media ranges are skipped.
+func parseAccept(accept []string) []acceptRange {
+	var ranges []acceptRange
+	for _, value := range accept {
+		for _, mediaRange := range strings.Split(value, ",") {
+			mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(mediaRange))
+			if err != nil {
+				continue
+			}
+			q := 1.0
+			if value, ok := params["q"]; ok {
+				if q, err = strconv.ParseFloat(value, 64); err != nil {
+					continue
+				}
+			}
+			ranges = append(ranges, acceptRange{mediaType: mediaType, q: q})
+		}
+	}
+	return ranges
+}
+
+// negotiateResponseFormat returns the media type of the response format preferred by the Accept header values:
+// the supported media type with the highest q-value, the first one listed on ties. Wildcard ranges select JSON,
+// or text/plain for text/*. It defaults to JSON when no supported format is acceptable.
+func negotiateResponseFormat(accept []string) string {
+	best, bestQ := "application/json", 0.0
+	for _, r := range parseAccept(accept) {
+		mediaType := r.mediaType
+		switch mediaType {
+		case runtime.MIMEWildcard, "application/*":
+			mediaType = "application/json"
+		case "text/*":
+			mediaType = MIMEText
+		}
+		if _, ok := responseFormats[mediaType]; ok && r.q > bestQ {
+			best, bestQ = mediaType, r.q
+		}
+	}
+	return best
+}
+
+// withResponseFormat selects the marshaler of the gateway responses from the Accept header only, and records it
+// in the access log. The gateway matches the Accept header exactly, and falls back to the marshaler of the
+// Content-Type of the request, so it gets a copy of the request with the negotiated Accept header.
+// It must be wrapped by withHTTPRequest, which keeps the original request for the handlers.
+func withResponseFormat(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		format := negotiateResponseFormat(r.Header.Values("Accept"))
+		setAccessLogMarshaler(r.Context(), responseFormats[format])
+		r = r.Clone(r.Context())
+		r.Header.Set("Accept", format)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// httpBodyLogger is a forward response option recording the google.api.HttpBody responses in the access log,
+// as they are written as is, whatever the marshaler
+func httpBodyLogger(ctx context.Context, _ http.ResponseWriter, resp proto.Message) error {
+	if _, ok := resp.(*httpbody.HttpBody); ok {
+		setAccessLogMarshaler(ctx, "httpbody")
+	}
+	return nil
+}
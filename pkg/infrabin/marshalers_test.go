@@ -0,0 +1,190 @@
+package infrabin
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/handlers"
+	"github.com/spf13/viper"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestMarshalers(t *testing.T) {
+	testCases := []struct {
+		name                string
+		accept              string
+		expectedContentType string
+		check               func(t *testing.T, body []byte)
+	}{
+		{
+			name:                "default json",
+			expectedContentType: "application/json",
+			check: func(t *testing.T, body []byte) {
+				if !bytes.Contains(body, []byte(`"proto":"HTTP/1.1"`)) {
+					t.Errorf("expected a JSON body, got %s", body)
+				}
+			},
+		},
+		{
+			name:                "json with parameters",
+			accept:              "application/json; charset=utf-8",
+			expectedContentType: "application/json",
+			check: func(t *testing.T, body []byte) {
+				if !bytes.Contains(body, []byte(`"proto":"HTTP/1.1"`)) {
+					t.Errorf("expected a JSON body, got %s", body)
+				}
+			},
+		},
+		{
+			name:                "unsupported",
+			accept:              "image/png",
+			expectedContentType: "application/json",
+			check: func(t *testing.T, body []byte) {
+				if !bytes.Contains(body, []byte(`"proto":"HTTP/1.1"`)) {
+					t.Errorf("expected a JSON body, got %s", body)
+				}
+			},
+		},
+		{
+			name:                "protobuf",
+			accept:              MIMEProtobuf,
+			expectedContentType: MIMEProtobuf,
+			check: func(t *testing.T, body []byte) {
+				var got Response
+				if err := proto.Unmarshal(body, &got); err != nil {
+					t.Fatalf("failed to unmarshal protobuf body: %v", err)
+				}
+				if got.Anything.GetProto() != "HTTP/1.1" {
+					t.Errorf("unexpected response: %v", got.Anything)
+				}
+			},
+		},
+		{
+			name:                "yaml",
+			accept:              MIMEYAML,
+			expectedContentType: MIMEYAML,
+			check: func(t *testing.T, body []byte) {
+				if !bytes.Contains(body, []byte("---\nanything:\n    method: GET\n")) {
+					t.Errorf("expected a block style YAML body, got %s", body)
+				}
+			},
+		},
+		{
+			name:                "yaml with q-values",
+			accept:              "text/plain;q=0.5, application/yaml, */*;q=0.1",
+			expectedContentType: MIMEYAML,
+			check: func(t *testing.T, body []byte) {
+				if !bytes.HasPrefix(body, []byte("---\n")) {
+					t.Errorf("expected a YAML body, got %s", body)
+				}
+			},
+		},
+		{
+			name:                "text",
+			accept:              MIMEText,
+			expectedContentType: "text/plain; charset=utf-8",
+			check: func(t *testing.T, body []byte) {
+				for _, line := range []string{"anything.method=GET", "anything.args.a=1", `anything.headers.User-Agent="curl 8"`} {
+					if !bytes.Contains(body, []byte(line+"\n")) {
+						t.Errorf("expected line %q in body:\n%s", line, body)
+					}
+				}
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/anything?a=1", nil)
+			req.Header.Set("User-Agent", "curl 8")
+			if tc.accept != "" {
+				req.Header.Set("Accept", tc.accept)
+			}
+			rr := httptest.NewRecorder()
+			handler := newHTTPInfrabinHandler()
+			handler.ServeHTTP(rr, req)
+
+			if rr.Code != http.StatusOK {
+				t.Fatalf("handler returned wrong status code: got %v want %v: %s", rr.Code, http.StatusOK, rr.Body.String())
+			}
+			if got := rr.Header().Get("Content-Type"); got != tc.expectedContentType {
+				t.Errorf("Content-Type = %q, want %q", got, tc.expectedContentType)
+			}
+			tc.check(t, rr.Body.Bytes())
+		})
+	}
+}
+
+func TestYAMLRequestBody(t *testing.T) {
+	body := "status: 201\nbody: created\n"
+	req := httptest.NewRequest("POST", "/response", strings.NewReader(body))
+	req.Header.Set("Content-Type", MIMEYAML)
+	rr := httptest.NewRecorder()
+	handler := newHTTPInfrabinHandler()
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("handler returned wrong status code: got %v want %v: %s", rr.Code, http.StatusCreated, rr.Body.String())
+	}
+	if rr.Body.String() != "created" {
+		t.Errorf("body = %q, want %q", rr.Body.String(), "created")
+	}
+}
+
+func TestResponseFormatIgnoresContentType(t *testing.T) {
+	viper.Set("maxBodySize", MaxBodySize)
+	defer viper.Reset()
+
+	req := httptest.NewRequest("PUT", "/anything", strings.NewReader("hello"))
+	req.Header.Set("Content-Type", MIMEText)
+	rr := httptest.NewRecorder()
+	handler := newHTTPInfrabinHandler()
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("handler returned wrong status code: got %v want %v: %s", rr.Code, http.StatusOK, rr.Body.String())
+	}
+	if got := rr.Header().Get("Content-Type"); got != "application/json" {
+		t.Errorf("Content-Type = %q, want %q", got, "application/json")
+	}
+}
+
+func TestAccessLogMarshaler(t *testing.T) {
+	testCases := []struct {
+		name     string
+		path     string
+		accept   string
+		expected string
+	}{
+		{name: "json", path: "/headers", expected: `"json"`},
+		{name: "yaml", path: "/headers", accept: MIMEYAML, expected: `"yaml"`},
+		{name: "negotiated", path: "/headers", accept: "application/yaml;q=0.5, text/*", expected: `"text"`},
+		{name: "error", path: "/status/404", accept: MIMEText, expected: `"text"`},
+		{name: "httpbody", path: "/gzip", accept: MIMEYAML, expected: `"httpbody"`},
+		{name: "not a gateway response", path: "/openapi.json", expected: `"-"`},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			srv, err := NewHTTPServer("test", RegisterInfrabin("/", &InfrabinService{}), RegisterOpenAPI("/openapi.json"))
+			if err != nil {
+				t.Fatalf("NewHTTPServer() error = %v", err)
+			}
+			var log bytes.Buffer
+			handler := withAccessLogFields(handlers.CustomLoggingHandler(&log, srv.Server.Handler, RequestLoggingFormatter))
+
+			req := httptest.NewRequest("GET", tc.path, nil)
+			if tc.accept != "" {
+				req.Header.Set("Accept", tc.accept)
+			}
+			handler.ServeHTTP(httptest.NewRecorder(), req)
+
+			if line := strings.TrimSpace(log.String()); !strings.HasSuffix(line, tc.expected) {
+				t.Errorf("access log %q does not end with %s", line, tc.expected)
+			}
+		})
+	}
+}
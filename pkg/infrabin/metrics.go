@@ -27,6 +27,14 @@ var (
 		},
 		[]string{"method", "handler"},
 	)
+
+	webSocketClosesTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "infrabin_websocket_closes_total",
+			Help: "Total number of closed WebSocket connections by close code",
+		},
+		[]string{"code"},
+	)
 )
 
 // metricsResponseWriter wraps http.ResponseWriter to capture status code
@@ -40,6 +48,11 @@ func (mrw *metricsResponseWriter) WriteHeader(code int) {
 	mrw.ResponseWriter.WriteHeader(code)
 }
 
+// Unwrap returns the wrapped http.ResponseWriter, so that http.ResponseController can flush streams
+func (mrw *metricsResponseWriter) Unwrap() http.ResponseWriter {
+	return mrw.ResponseWriter
+}
+
 // HTTPMetricsMiddleware instruments HTTP requests with Prometheus metrics
 func HTTPMetricsMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -94,8 +107,54 @@ func normalizeRoute(path string) string {
 			return "intermittent"
 		case "any":
 			return "any"
+		case "anything":
+			return "anything"
+		case "ip":
+			return "ip"
+		case "response-headers":
+			return "response-headers"
+		case "response":
+			return "response"
+		case "redirect":
+			return "redirect"
+		case "relative-redirect":
+			return "relative-redirect"
+		case "absolute-redirect":
+			return "absolute-redirect"
+		case "redirect-to":
+			return "redirect-to"
+		case "cookies":
+			return "cookies"
+		case "gzip":
+			return "gzip"
+		case "deflate":
+			return "deflate"
+		case "brotli":
+			return "brotli"
+		case "basic-auth":
+			return "basic-auth"
+		case "bearer":
+			return "bearer"
+		case "digest-auth":
+			return "digest-auth"
+		case "cache":
+			return "cache"
+		case "etag":
+			return "etag"
+		case "range":
+			return "range"
+		case "stream-bytes":
+			return "stream-bytes"
+		case "upload":
+			return "upload"
 		case "bytes":
 			return "bytes"
+		case "status":
+			return "status"
+		case "fail":
+			return "fail"
+		case "stream":
+			return "stream"
 		case "aws":
 			// Handle AWS sub-paths
 			if len(parts) >= 2 {
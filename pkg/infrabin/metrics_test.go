@@ -65,6 +65,81 @@ func TestNormalizeRoute(t *testing.T) {
 			path:          "/intermittent",
 			expectedRoute: "intermittent",
 		},
+		{
+			name:          "status with code",
+			path:          "/status/200:90,503:10",
+			expectedRoute: "status",
+		},
+		{
+			name:          "fail with rpc and state",
+			path:          "/fail/root/on",
+			expectedRoute: "fail",
+		},
+		{
+			name:          "anything with path",
+			path:          "/anything/foo/bar",
+			expectedRoute: "anything",
+		},
+		{
+			name:          "stream with count",
+			path:          "/stream/10",
+			expectedRoute: "stream",
+		},
+		{
+			name:          "response headers",
+			path:          "/response-headers",
+			expectedRoute: "response-headers",
+		},
+		{
+			name:          "response",
+			path:          "/response",
+			expectedRoute: "response",
+		},
+		{
+			name:          "redirect with count",
+			path:          "/relative-redirect/3",
+			expectedRoute: "relative-redirect",
+		},
+		{
+			name:          "cookies set",
+			path:          "/cookies/set",
+			expectedRoute: "cookies",
+		},
+		{
+			name:          "gzip",
+			path:          "/gzip",
+			expectedRoute: "gzip",
+		},
+		{
+			name:          "basic auth with credentials",
+			path:          "/basic-auth/user/passwd",
+			expectedRoute: "basic-auth",
+		},
+		{
+			name:          "cache with seconds",
+			path:          "/cache/60",
+			expectedRoute: "cache",
+		},
+		{
+			name:          "etag",
+			path:          "/etag/abc",
+			expectedRoute: "etag",
+		},
+		{
+			name:          "range with size",
+			path:          "/range/1024",
+			expectedRoute: "range",
+		},
+		{
+			name:          "stream bytes with size",
+			path:          "/stream-bytes/1024",
+			expectedRoute: "stream-bytes",
+		},
+		{
+			name:          "upload",
+			path:          "/upload",
+			expectedRoute: "upload",
+		},
 		{
 			name:          "unknown endpoint returns first segment",
 			path:          "/unknown/path",
@@ -0,0 +1,188 @@
+package infrabin
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"time"
+
+	"google.golang.org/genproto/googleapis/api/httpbody"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// MaxRangeSize is the maximum size of the payload of the range endpoint
+const MaxRangeSize = 10 << 20
+
+// rangeLastModified is the Last-Modified date of the range payloads, which never change
+var rangeLastModified = time.Unix(0, 0).UTC()
+
+// byteRange is a range of the payload, as requested by a Range header
+type byteRange struct {
+	start  int64
+	length int64
+}
+
+// contentRange returns the Content-Range header value of the range of a payload of size bytes
+func (r byteRange) contentRange(size int64) string {
+	return fmt.Sprintf("bytes %d-%d/%d", r.start, r.start+r.length-1, size)
+}
+
+// Range returns request.N deterministic bytes, "abcdefghijklmnopqrstuvwxyzabcd...", with a fixed ETag,
+// so that clients and caches can resume downloads or cache ranges of the payload.
+// It honours the Range header with 206 Partial Content, as multipart/byteranges for several ranges,
+// or 416 Range Not Satisfiable, unless the If-Range header does not match the payload.
+func (s *InfrabinService) Range(ctx context.Context, request *RangeRequest) (*httpbody.HttpBody, error) {
+	if request.N < 1 || request.N > MaxRangeSize {
+		return nil, status.Errorf(codes.InvalidArgument, "n must be between 1 and %d", MaxRangeSize)
+	}
+	size := int64(request.N)
+	etag := quoteETag(fmt.Sprintf("range-%d", size))
+	header := http.Header{
+		"Accept-Ranges": {"bytes"},
+		"ETag":          {etag},
+		"Last-Modified": {rangeLastModified.Format(http.TimeFormat)},
+	}
+
+	ranges, ok := requestedRanges(ctx, size, etag)
+	body := &httpbody.HttpBody{ContentType: "application/octet-stream"}
+	switch {
+	case !ok:
+		body.Data = rangePayload(byteRange{start: 0, length: size})
+	case len(ranges) == 0:
+		setHTTPCode(ctx, http.StatusRequestedRangeNotSatisfiable)
+		header.Set("Content-Range", fmt.Sprintf("bytes */%d", size))
+	case len(ranges) == 1:
+		setHTTPCode(ctx, http.StatusPartialContent)
+		header.Set("Content-Range", ranges[0].contentRange(size))
+		body.Data = rangePayload(ranges[0])
+	default:
+		setHTTPCode(ctx, http.StatusPartialContent)
+		var buf bytes.Buffer
+		mw := multipart.NewWriter(&buf)
+		for _, r := range ranges {
+			part, err := mw.CreatePart(textproto.MIMEHeader{
+				"Content-Type":  {"application/octet-stream"},
+				"Content-Range": {r.contentRange(size)},
+			})
+			if err != nil {
+				return nil, status.Errorf(codes.Internal, "cannot write range: %v", err)
+			}
+			_, _ = part.Write(rangePayload(r))
+		}
+		if err := mw.Close(); err != nil {
+			return nil, status.Errorf(codes.Internal, "cannot write ranges: %v", err)
+		}
+		body.ContentType = "multipart/byteranges; boundary=" + mw.Boundary()
+		body.Data = buf.Bytes()
+	}
+
+	if err := setHTTPHeaders(ctx, header); err != nil {
+		return nil, err
+	}
+	return body, nil
+}
+
+// requestedRanges returns the satisfiable ranges of the Range header of the request, if it must be honoured.
+// The Range header is ignored when it is missing or invalid, when the If-Range header does not match
+// the payload, or when the ranges are larger than the payload, as net/http does.
+func requestedRanges(ctx context.Context, size int64, etag string) ([]byteRange, bool) {
+	values := requestHeader(ctx, "Range")
+	if len(values) != 1 {
+		return nil, false
+	}
+	if ifRange := requestHeader(ctx, "If-Range"); len(ifRange) > 0 && !matchIfRange(ifRange[0], etag) {
+		return nil, false
+	}
+	ranges, ok := parseRange(values[0], size)
+	if !ok {
+		return nil, false
+	}
+	var total int64
+	for _, r := range ranges {
+		total += r.length
+	}
+	if total > size {
+		return nil, false
+	}
+	return ranges, true
+}
+
+// matchIfRange reports whether the If-Range header matches the payload, with a strong comparison of the ETag,
+// or an exact match of the Last-Modified date
+func matchIfRange(value string, etag string) bool {
+	value = strings.TrimSpace(value)
+	if strings.HasPrefix(value, `"`) || strings.HasPrefix(value, "W/") {
+		return value == etag
+	}
+	t, err := http.ParseTime(value)
+	return err == nil && t.Equal(rangeLastModified)
+}
+
+// parseRange parses a Range header, e.g. "bytes=0-99, 200-, -50", into the ranges of a payload of size bytes.
+// It returns false if the header is invalid, and no ranges if none of them is satisfiable.
+func parseRange(value string, size int64) ([]byteRange, bool) {
+	specs, ok := strings.CutPrefix(strings.TrimSpace(value), "bytes=")
+	if !ok {
+		return nil, false
+	}
+	var (
+		ranges []byteRange
+		parsed int
+	)
+	for _, spec := range strings.Split(specs, ",") {
+		spec = strings.TrimSpace(spec)
+		if spec == "" {
+			continue
+		}
+		parsed++
+		first, last, ok := strings.Cut(spec, "-")
+		if !ok {
+			return nil, false
+		}
+		if first == "" {
+			// Suffix range: the last bytes of the payload
+			n, err := strconv.ParseInt(last, 10, 64)
+			if err != nil || n < 0 {
+				return nil, false
+			}
+			if n == 0 {
+				continue
+			}
+			n = min(n, size)
+			ranges = append(ranges, byteRange{start: size - n, length: n})
+			continue
+		}
+		start, err := strconv.ParseInt(first, 10, 64)
+		if err != nil || start < 0 {
+			return nil, false
+		}
+		end := size - 1
+		if last != "" {
+			end, err = strconv.ParseInt(last, 10, 64)
+			if err != nil || end < start {
+				return nil, false
+			}
+		}
+		if start >= size {
+			continue
+		}
+		end = min(end, size-1)
+		ranges = append(ranges, byteRange{start: start, length: end - start + 1})
+	}
+	return ranges, parsed > 0
+}
+
+// rangePayload returns the bytes of the range of the payload, the lowercase alphabet repeated
+func rangePayload(r byteRange) []byte {
+	data := make([]byte, r.length)
+	for i := range data {
+		data[i] = 'a' + byte((r.start+int64(i))%26)
+	}
+	return data
+}
@@ -0,0 +1,129 @@
+package infrabin
+
+import (
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestRangeHandler(t *testing.T) {
+	testCases := []struct {
+		name                 string
+		rangeHeader          string
+		ifRange              string
+		expectedStatus       int
+		expectedContentRange string
+		expectedBody         string
+	}{
+		{name: "no range", expectedStatus: http.StatusOK, expectedBody: "abcdefghijklmnopqrstuvwxyzabcd"},
+		{name: "single range", rangeHeader: "bytes=2-5", expectedStatus: http.StatusPartialContent, expectedContentRange: "bytes 2-5/30", expectedBody: "cdef"},
+		{name: "open range", rangeHeader: "bytes=27-", expectedStatus: http.StatusPartialContent, expectedContentRange: "bytes 27-29/30", expectedBody: "bcd"},
+		{name: "suffix range", rangeHeader: "bytes=-4", expectedStatus: http.StatusPartialContent, expectedContentRange: "bytes 26-29/30", expectedBody: "abcd"},
+		{name: "end past size", rangeHeader: "bytes=28-100", expectedStatus: http.StatusPartialContent, expectedContentRange: "bytes 28-29/30", expectedBody: "cd"},
+		{name: "unsatisfiable", rangeHeader: "bytes=30-40", expectedStatus: http.StatusRequestedRangeNotSatisfiable, expectedContentRange: "bytes */30"},
+		{name: "invalid range", rangeHeader: "bytes=5-2", expectedStatus: http.StatusOK, expectedBody: "abcdefghijklmnopqrstuvwxyzabcd"},
+		{name: "unknown unit", rangeHeader: "items=0-1", expectedStatus: http.StatusOK, expectedBody: "abcdefghijklmnopqrstuvwxyzabcd"},
+		{name: "if-range etag", rangeHeader: "bytes=0-1", ifRange: `"range-30"`, expectedStatus: http.StatusPartialContent, expectedContentRange: "bytes 0-1/30", expectedBody: "ab"},
+		{name: "if-range date", rangeHeader: "bytes=0-1", ifRange: "Thu, 01 Jan 1970 00:00:00 GMT", expectedStatus: http.StatusPartialContent, expectedContentRange: "bytes 0-1/30", expectedBody: "ab"},
+		{name: "if-range mismatch", rangeHeader: "bytes=0-1", ifRange: `"range-31"`, expectedStatus: http.StatusOK, expectedBody: "abcdefghijklmnopqrstuvwxyzabcd"},
+		{name: "if-range weak etag", rangeHeader: "bytes=0-1", ifRange: `W/"range-30"`, expectedStatus: http.StatusOK, expectedBody: "abcdefghijklmnopqrstuvwxyzabcd"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/range/30", nil)
+			if tc.rangeHeader != "" {
+				req.Header.Set("Range", tc.rangeHeader)
+			}
+			if tc.ifRange != "" {
+				req.Header.Set("If-Range", tc.ifRange)
+			}
+			rr := httptest.NewRecorder()
+			handler := newHTTPInfrabinHandler()
+			handler.ServeHTTP(rr, req)
+
+			if rr.Code != tc.expectedStatus {
+				t.Fatalf("handler returned wrong status code: got %v want %v: %s", rr.Code, tc.expectedStatus, rr.Body.String())
+			}
+			if got := rr.Header().Get("Accept-Ranges"); got != "bytes" {
+				t.Errorf("Accept-Ranges = %q, want bytes", got)
+			}
+			if got := rr.Header().Get("ETag"); got != `"range-30"` {
+				t.Errorf("ETag = %q, want %q", got, `"range-30"`)
+			}
+			if got := rr.Header().Get("Content-Range"); got != tc.expectedContentRange {
+				t.Errorf("Content-Range = %q, want %q", got, tc.expectedContentRange)
+			}
+			if rr.Body.String() != tc.expectedBody {
+				t.Errorf("body = %q, want %q", rr.Body.String(), tc.expectedBody)
+			}
+		})
+	}
+}
+
+func TestRangeHandlerMultipart(t *testing.T) {
+	req := httptest.NewRequest("GET", "/range/30", nil)
+	req.Header.Set("Range", "bytes=0-1, 40-50, -3")
+	rr := httptest.NewRecorder()
+	handler := newHTTPInfrabinHandler()
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusPartialContent {
+		t.Fatalf("handler returned wrong status code: got %v want %v: %s", rr.Code, http.StatusPartialContent, rr.Body.String())
+	}
+	mediaType, params, err := mime.ParseMediaType(rr.Header().Get("Content-Type"))
+	if err != nil || mediaType != "multipart/byteranges" {
+		t.Fatalf("Content-Type = %q, want multipart/byteranges", rr.Header().Get("Content-Type"))
+	}
+
+	var got []string
+	mr := multipart.NewReader(rr.Body, params["boundary"])
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("failed to read part: %v", err)
+		}
+		data, _ := io.ReadAll(part)
+		got = append(got, part.Header.Get("Content-Range")+" "+string(data))
+	}
+	// The unsatisfiable range is skipped
+	expected := []string{"bytes 0-1/30 ab", "bytes 27-29/30 bcd"}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("parts = %q, want %q", got, expected)
+	}
+}
+
+func TestRangeHandlerInvalid(t *testing.T) {
+	for _, path := range []string{"/range/0", "/range/-1", "/range/20000000"} {
+		rr := httptest.NewRecorder()
+		handler := newHTTPInfrabinHandler()
+		handler.ServeHTTP(rr, httptest.NewRequest("GET", path, nil))
+
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("%s returned wrong status code: got %v want %v", path, rr.Code, http.StatusBadRequest)
+		}
+	}
+}
+
+func TestParseRange(t *testing.T) {
+	ranges, ok := parseRange("bytes=0-0, 5-, -2", 10)
+	if !ok {
+		t.Fatalf("parseRange() failed")
+	}
+	expected := []byteRange{{start: 0, length: 1}, {start: 5, length: 5}, {start: 8, length: 2}}
+	if !reflect.DeepEqual(ranges, expected) {
+		t.Errorf("parseRange() = %v, want %v", ranges, expected)
+	}
+	for _, value := range []string{"bytes=", "bytes=a-b", "bytes=1", "0-1", "bytes=-"} {
+		if _, ok := parseRange(value, 10); ok {
+			t.Errorf("parseRange(%q) succeeded, want failure", value)
+		}
+	}
+}
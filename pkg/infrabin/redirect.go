@@ -0,0 +1,114 @@
+package infrabin
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/spf13/viper"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// MaxRedirects is the maximum number of redirects of the redirect endpoints
+const MaxRedirects = 100
+
+// redirectFinalPath is the path of the response returned after the last redirect.
+// The redirect endpoints and /anything accept POST, PUT, PATCH and DELETE, so the method preserved
+// by 307 and 308 redirects is accepted by every hop.
+const redirectFinalPath = "/anything"
+
+// Redirect redirects with relative or absolute Location headers, depending on request.Absolute.
+func (s *InfrabinService) Redirect(ctx context.Context, request *RedirectRequest) (*Response, error) {
+	if request.Absolute {
+		return s.AbsoluteRedirect(ctx, request)
+	}
+	return s.RelativeRedirect(ctx, request)
+}
+
+// RelativeRedirect redirects to /relative-redirect/{n-1}, or to /anything for the last redirect.
+func (s *InfrabinService) RelativeRedirect(ctx context.Context, request *RedirectRequest) (*Response, error) {
+	return redirectChain(ctx, request, "", "/relative-redirect")
+}
+
+// AbsoluteRedirect redirects to the absolute URL of /absolute-redirect/{n-1}, or of /anything for the last redirect.
+func (s *InfrabinService) AbsoluteRedirect(ctx context.Context, request *RedirectRequest) (*Response, error) {
+	return redirectChain(ctx, request, redirectBaseURL(ctx), "/absolute-redirect")
+}
+
+// RedirectTo redirects to request.Url, if it matches the redirectAllowRegexp regexp.
+func (s *InfrabinService) RedirectTo(ctx context.Context, request *RedirectToRequest) (*Response, error) {
+	if request.Url == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "url must be set")
+	}
+	if _, err := url.Parse(request.Url); err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid url: %v", err)
+	}
+
+	exp := viper.GetString("redirectAllowRegexp")
+	r, err := regexp.Compile(exp)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "Unable to compile %s regexp: %v", exp, err)
+	}
+	if !r.MatchString(request.Url) {
+		return nil, status.Errorf(codes.InvalidArgument, "Unable to redirect as the target URL %s is blocked by the regexp %s", request.Url, exp)
+	}
+	return redirect(ctx, request.Url, request.Status)
+}
+
+// redirectChain redirects to the next hop of the chain at path, prefixed by base, or to /anything for the last hop.
+// A non-default status is kept in the Location, so that every hop uses the same status code.
+func redirectChain(ctx context.Context, request *RedirectRequest, base string, path string) (*Response, error) {
+	if request.N < 1 || request.N > MaxRedirects {
+		return nil, status.Errorf(codes.InvalidArgument, "n must be between 1 and %d", MaxRedirects)
+	}
+	location := base + redirectFinalPath
+	if request.N > 1 {
+		location = fmt.Sprintf("%s%s/%d", base, path, request.N-1)
+		if request.Status != 0 {
+			location += fmt.Sprintf("?status=%d", request.Status)
+		}
+	}
+	return redirect(ctx, location, request.Status)
+}
+
+// redirect validates the status code, and sets the HTTP status code and Location header of the response.
+func redirect(ctx context.Context, location string, code int32) (*Response, error) {
+	if code == 0 {
+		code = http.StatusFound
+	}
+	switch code {
+	case http.StatusMovedPermanently, http.StatusFound, http.StatusSeeOther, http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+	default:
+		return nil, status.Errorf(codes.InvalidArgument, "status must be one of 301, 302, 303, 307 or 308")
+	}
+
+	if err := setHTTPHeaders(ctx, http.Header{"Location": {location}}); err != nil {
+		return nil, err
+	}
+	setHTTPCode(ctx, int(code))
+
+	hostname, err := os.Hostname()
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "cannot get hostname: %v", err)
+	}
+	return &Response{
+		Hostname: hostname,
+		Redirect: &RedirectResponse{Location: location, Status: code},
+	}, nil
+}
+
+// redirectBaseURL returns the scheme and host of the request, as seen by the client after the proxy headers.
+// gRPC requests use the :authority pseudo-header.
+func redirectBaseURL(ctx context.Context) string {
+	if r, ok := httpRequestFromContext(ctx); ok {
+		return requestScheme(r) + "://" + r.Host
+	}
+	md, _ := metadata.FromIncomingContext(ctx)
+	return "http://" + strings.Join(md.Get(":authority"), ",")
+}
@@ -0,0 +1,171 @@
+package infrabin
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/textproto"
+	"os"
+	"strings"
+	"text/template"
+	"time"
+
+	"golang.org/x/net/http/httpguts"
+	"google.golang.org/genproto/googleapis/api/httpbody"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// DefaultResponseContentType is the content type of the /response body when none is requested
+const DefaultResponseContentType = "text/plain; charset=utf-8"
+
+// reservedResponseHeaders are the headers managed by the HTTP server, which cannot be set by the caller
+var reservedResponseHeaders = map[string]bool{
+	"Connection":        true,
+	"Content-Length":    true,
+	"Trailer":           true,
+	"Transfer-Encoding": true,
+	"Upgrade":           true,
+}
+
+// ResponseHeaders sets the requested response headers, and returns them.
+// Requests from the gateway use the query parameters, so that any header name can be set.
+func (s *InfrabinService) ResponseHeaders(ctx context.Context, request *ResponseHeadersRequest) (*Response, error) {
+	header := http.Header{}
+	if r, ok := httpRequestFromContext(ctx); ok {
+		for name, values := range r.URL.Query() {
+			for _, value := range values {
+				header.Add(name, value)
+			}
+		}
+	} else {
+		for name, value := range request.Headers {
+			header.Add(name, value)
+		}
+	}
+	if err := setHTTPHeaders(ctx, header); err != nil {
+		return nil, err
+	}
+
+	hostname, err := os.Hostname()
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "cannot get hostname: %v", err)
+	}
+	return &Response{Hostname: hostname, ResponseHeaders: joinValues(header)}, nil
+}
+
+// customResponseData is the data available to the /response templates
+type customResponseData struct {
+	Hostname string
+	Time     time.Time
+	Status   int
+	Request  *AnythingResponse
+}
+
+// CustomResponse returns the response described by the request.
+func (s *InfrabinService) CustomResponse(ctx context.Context, request *CustomResponseRequest) (*httpbody.HttpBody, error) {
+	code := http.StatusOK
+	if request.Status != 0 {
+		code = int(request.Status)
+	}
+	if code < 200 || code > 599 {
+		return nil, status.Errorf(codes.InvalidArgument, "status must be between 200 and 599")
+	}
+	if request.Body != "" && request.Template != "" {
+		return nil, status.Errorf(codes.InvalidArgument, "body and template are mutually exclusive")
+	}
+
+	header := http.Header{}
+	for _, line := range request.Header {
+		name, value, ok := strings.Cut(line, ":")
+		if !ok {
+			return nil, status.Errorf(codes.InvalidArgument, "header %q must be in the \"Name: value\" format", line)
+		}
+		header.Add(strings.TrimSpace(name), strings.TrimSpace(value))
+	}
+	contentType := request.ContentType
+	if contentType == "" {
+		contentType = header.Get("Content-Type")
+	}
+	if contentType == "" {
+		contentType = DefaultResponseContentType
+	}
+	header.Del("Content-Type")
+
+	body := []byte(request.Body)
+	if request.Template != "" {
+		var err error
+		if body, err = renderCustomResponse(ctx, request.Template, code); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := setHTTPHeaders(ctx, header); err != nil {
+		return nil, err
+	}
+	setHTTPCode(ctx, code)
+	return &httpbody.HttpBody{ContentType: contentType, Data: body}, nil
+}
+
+// renderCustomResponse renders the body template of a /response request
+func renderCustomResponse(ctx context.Context, text string, code int) ([]byte, error) {
+	tmpl, err := template.New("response").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid template: %v", err)
+	}
+	hostname, err := os.Hostname()
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "cannot get hostname: %v", err)
+	}
+	data := customResponseData{Hostname: hostname, Time: time.Now(), Status: code}
+	if r, ok := httpRequestFromContext(ctx); ok {
+		data.Request = describeHTTPRequest(r)
+	} else {
+		data.Request = describeGRPCRequest(ctx)
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "cannot render template: %v", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// setHTTPHeaders validates the headers, and sends them as HTTPHeaderPrefix headers so that the gateway
+// sets them on the HTTP response.
+func setHTTPHeaders(ctx context.Context, header http.Header) error {
+	md := metadata.MD{}
+	for name, values := range header {
+		// The headers are forwarded as gRPC metadata, whose keys are more restricted than the HTTP header names
+		if !httpguts.ValidHeaderFieldName(name) || !validMetadataKey(strings.ToLower(name)) {
+			return status.Errorf(codes.InvalidArgument, "invalid header name %q", name)
+		}
+		if reservedResponseHeaders[textproto.CanonicalMIMEHeaderKey(name)] {
+			return status.Errorf(codes.InvalidArgument, "header %q cannot be set", name)
+		}
+		for _, value := range values {
+			if !httpguts.ValidHeaderFieldValue(value) {
+				return status.Errorf(codes.InvalidArgument, "invalid value for header %q", name)
+			}
+		}
+		md.Append(HTTPHeaderPrefix+strings.ToLower(name), values...)
+	}
+	if md.Len() == 0 {
+		return nil
+	}
+	// The error is ignored like in setHTTPCode
+	_ = grpc.SetHeader(ctx, md)
+	return nil
+}
+
+// validMetadataKey returns true if the key only contains the characters allowed by gRPC in metadata keys: 0-9 a-z - _ .
+func validMetadataKey(key string) bool {
+	for _, c := range key {
+		if !(c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c == '-' || c == '_' || c == '.') {
+			return false
+		}
+	}
+	return true
+}
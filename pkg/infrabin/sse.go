@@ -0,0 +1,111 @@
+package infrabin
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// DefaultSSECount is the default number of events sent by the /sse endpoint
+const DefaultSSECount = 10
+
+// sseEvent is the data of the events sent by the /sse endpoint
+type sseEvent struct {
+	Hostname string `json:"hostname"`
+	ID       int    `json:"id"`
+	Count    int    `json:"count"`
+	Time     string `json:"time"`
+	// ResumedFrom is the Last-Event-ID sent by the client when reconnecting, if any
+	ResumedFrom int `json:"resumed_from,omitempty"`
+}
+
+// RegisterSSE registers a Server-Sent Events handler at pattern.
+// The handler sends count events at the given interval, with IDs from 1 to count.
+// A client reconnecting with a Last-Event-ID header resumes from the next ID.
+func RegisterSSE(pattern string) HTTPServerOption {
+	return func(ctx context.Context, s *HTTPServer) error {
+		serveMux, ok := s.Server.Handler.(*http.ServeMux)
+		if !ok {
+			return fmt.Errorf("handler is not *http.ServeMux")
+		}
+		serveMux.HandleFunc(pattern, sseHandler)
+		return nil
+	}
+}
+
+func sseHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	count := DefaultSSECount
+	if value := query.Get("count"); value != "" {
+		var err error
+		if count, err = strconv.Atoi(value); err != nil {
+			writeStatusError(w, http.StatusBadRequest, status.Errorf(codes.InvalidArgument, "count must be a number: %q", value))
+			return
+		}
+	}
+	interval, err := parseStreamInterval(int64(count), query.Get("interval"))
+	if err != nil {
+		writeStatusError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	var lastEventID int
+	if value := r.Header.Get("Last-Event-ID"); value != "" {
+		var err error
+		if lastEventID, err = strconv.Atoi(value); err != nil || lastEventID < 0 {
+			writeStatusError(w, http.StatusBadRequest, status.Errorf(codes.InvalidArgument, "Last-Event-ID must be an event ID: %q", value))
+			return
+		}
+	}
+	if lastEventID >= count {
+		// The stream is over: 204 No Content stops EventSource clients from reconnecting
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	hostname, err := os.Hostname()
+	if err != nil {
+		writeStatusError(w, http.StatusInternalServerError, status.Errorf(codes.Internal, "cannot get hostname: %v", err))
+		return
+	}
+
+	rc := http.NewResponseController(w)
+	extendStreamWriteDeadline(rc, int64(count-lastEventID), interval)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	if err := rc.Flush(); err != nil {
+		return
+	}
+
+	ctx := r.Context()
+	for id := lastEventID + 1; id <= count; id++ {
+		if id > lastEventID+1 {
+			select {
+			case <-time.After(interval):
+			case <-ctx.Done():
+				return
+			}
+		}
+		data, _ := json.Marshal(sseEvent{
+			Hostname:    hostname,
+			ID:          id,
+			Count:       count,
+			Time:        time.Now().Format(time.RFC3339Nano),
+			ResumedFrom: lastEventID,
+		})
+		if _, err := fmt.Fprintf(w, "id: %d\nevent: infrabin\ndata: %s\n\n", id, data); err != nil {
+			return
+		}
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,167 @@
+package infrabin
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+func TestSSEHandler(t *testing.T) {
+	viper.Set("maxDelay", MaxDelay)
+	srv, err := NewHTTPServer("test-sse", RegisterSSE("/sse"))
+	if err != nil {
+		t.Fatalf("Failed to create HTTP server: %v", err)
+	}
+
+	testCases := []struct {
+		name           string
+		path           string
+		lastEventID    string
+		expectedStatus int
+		expectedIDs    []string
+	}{
+		{
+			name:           "count events",
+			path:           "/sse?count=3&interval=10ms",
+			expectedStatus: http.StatusOK,
+			expectedIDs:    []string{"1", "2", "3"},
+		},
+		{
+			name:           "resume after Last-Event-ID",
+			path:           "/sse?count=3&interval=10ms",
+			lastEventID:    "1",
+			expectedStatus: http.StatusOK,
+			expectedIDs:    []string{"2", "3"},
+		},
+		{
+			name:           "resume at the end",
+			path:           "/sse?count=3",
+			lastEventID:    "3",
+			expectedStatus: http.StatusNoContent,
+		},
+		{
+			name:           "resume past the end",
+			path:           "/sse?count=3",
+			lastEventID:    "4",
+			expectedStatus: http.StatusNoContent,
+		},
+		{
+			name:           "invalid count",
+			path:           "/sse?count=0",
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "count too large",
+			path:           "/sse?count=10001",
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "zero interval",
+			path:           "/sse?count=3&interval=0",
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "invalid Last-Event-ID",
+			path:           "/sse",
+			lastEventID:    "abc",
+			expectedStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", tc.path, nil)
+			if tc.lastEventID != "" {
+				req.Header.Set("Last-Event-ID", tc.lastEventID)
+			}
+			rr := httptest.NewRecorder()
+			srv.Server.Handler.ServeHTTP(rr, req)
+
+			if rr.Code != tc.expectedStatus {
+				t.Fatalf("handler returned wrong status code: got %v want %v", rr.Code, tc.expectedStatus)
+			}
+			if tc.expectedStatus != http.StatusOK {
+				return
+			}
+			if contentType := rr.Header().Get("Content-Type"); contentType != "text/event-stream" {
+				t.Errorf("handler returned wrong Content-Type: got %v want text/event-stream", contentType)
+			}
+
+			var ids []string
+			for _, line := range strings.Split(rr.Body.String(), "\n") {
+				if id, ok := strings.CutPrefix(line, "id: "); ok {
+					ids = append(ids, id)
+				}
+			}
+			if strings.Join(ids, ",") != strings.Join(tc.expectedIDs, ",") {
+				t.Errorf("handler returned event IDs %v, want %v", ids, tc.expectedIDs)
+			}
+			if tc.lastEventID != "" && !strings.Contains(rr.Body.String(), `"resumed_from":`+tc.lastEventID) {
+				t.Errorf("handler did not report the resumed Last-Event-ID: %s", rr.Body.String())
+			}
+		})
+	}
+}
+
+func TestSSEHandlerStreams(t *testing.T) {
+	viper.Set("maxDelay", MaxDelay)
+	srv, err := NewHTTPServer("test-sse", RegisterSSE("/sse"))
+	if err != nil {
+		t.Fatalf("Failed to create HTTP server: %v", err)
+	}
+	server := httptest.NewServer(srv.Server.Handler)
+	defer server.Close()
+
+	// The first event must be received before the stream ends
+	start := time.Now()
+	resp, err := http.Get(server.URL + "/sse?count=2&interval=1s")
+	if err != nil {
+		t.Fatalf("GET /sse returned unexpected error: %v", err)
+	}
+	defer resp.Body.Close()
+
+	buf := make([]byte, 1024)
+	n, err := resp.Body.Read(buf)
+	if err != nil {
+		t.Fatalf("reading the first event returned unexpected error: %v", err)
+	}
+	if !strings.HasPrefix(string(buf[:n]), "id: 1\n") {
+		t.Errorf("first event = %q, want id 1", buf[:n])
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("first event received after %v, want it immediately", elapsed)
+	}
+}
+
+func TestSSEHandlerWriteTimeout(t *testing.T) {
+	viper.Set("maxDelay", MaxDelay)
+	viper.Set("httpWriteTimeout", 100*time.Millisecond)
+	defer viper.Set("httpWriteTimeout", HTTPWriteTimeout)
+	srv, err := NewHTTPServer("test-sse", RegisterSSE("/sse"))
+	if err != nil {
+		t.Fatalf("Failed to create HTTP server: %v", err)
+	}
+	server := httptest.NewUnstartedServer(srv.Server.Handler)
+	server.Config.WriteTimeout = 100 * time.Millisecond
+	server.Start()
+	defer server.Close()
+
+	// The stream takes 300ms, longer than the write timeout
+	resp, err := http.Get(server.URL + "/sse?count=4&interval=100ms")
+	if err != nil {
+		t.Fatalf("GET /sse returned unexpected error: %v", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("reading the events returned unexpected error: %v", err)
+	}
+	if events := strings.Count(string(body), "id: "); events != 4 {
+		t.Errorf("handler sent %d events, want 4: %s", events, body)
+	}
+}
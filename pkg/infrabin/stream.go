@@ -0,0 +1,325 @@
+package infrabin
+
+import (
+	"context"
+	"crypto/rand"
+	"io"
+	"net/http"
+	"net/textproto"
+	"strconv"
+	"time"
+
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"github.com/maruina/go-infrabin/internal/helpers"
+	"github.com/spf13/viper"
+	"google.golang.org/genproto/googleapis/api/httpbody"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+// MaxStreamCount is the maximum number of messages of the streaming endpoints
+const MaxStreamCount = 10000
+
+// MinStreamInterval is the minimum interval between the messages of the streaming endpoints
+const MinStreamInterval = 10 * time.Millisecond
+
+// parseStreamInterval validates the number of messages of a streaming endpoint and parses the interval
+// between them: a Go duration or a number of seconds, 1 second when empty, capped by maxDelay.
+// It returns an InvalidArgument status error.
+func parseStreamInterval(count int64, value string) (time.Duration, error) {
+	if count < 1 || count > MaxStreamCount {
+		return 0, status.Errorf(codes.InvalidArgument, "count must be between 1 and %d", MaxStreamCount)
+	}
+	interval := time.Second
+	if value != "" {
+		var err error
+		if interval, err = parseDelayDuration(value); err != nil {
+			return 0, status.Errorf(codes.InvalidArgument, "invalid interval: %v", err)
+		}
+		if interval < MinStreamInterval {
+			return 0, status.Errorf(codes.InvalidArgument, "interval must be at least %s", MinStreamInterval)
+		}
+	}
+	return helpers.MinDuration(interval, viper.GetDuration("maxDelay")), nil
+}
+
+// extendStreamWriteDeadline extends the write deadline of a stream of count messages at interval,
+// so that it is not cut by the server write timeout, which is kept as slack for the last message.
+func extendStreamWriteDeadline(rc *http.ResponseController, count int64, interval time.Duration) {
+	if timeout := viper.GetDuration("httpWriteTimeout"); timeout > 0 {
+		_ = rc.SetWriteDeadline(time.Now().Add(time.Duration(count-1)*interval + timeout))
+	}
+}
+
+// registerInfrabinStreamHandlers registers the server-streaming RPCs on the gateway mux.
+// RegisterInfrabinHandlerServer does not support streaming in-process, so the RPCs are called
+// with an inProcessStreamClient instead, the same way as RegisterInfrabinHandlerClient does.
+// The handlers are registered after RegisterInfrabinHandlerServer, so they take precedence.
+func registerInfrabinStreamHandlers(mux *runtime.ServeMux, server InfrabinServer) {
+	client := &inProcessStreamClient{server: server}
+
+	mux.Handle(http.MethodGet, pattern_Infrabin_Stream_0, func(w http.ResponseWriter, req *http.Request, pathParams map[string]string) {
+		ctx, cancel := context.WithCancel(req.Context())
+		defer cancel()
+		inboundMarshaler, outboundMarshaler := runtime.MarshalerForRequest(mux, req)
+		annotatedContext, err := runtime.AnnotateIncomingContext(ctx, mux, req, "/infrabin.Infrabin/Stream", runtime.WithHTTPPathPattern("/stream/{count}"))
+		if err != nil {
+			runtime.HTTPError(ctx, mux, outboundMarshaler, w, req, err)
+			return
+		}
+		resp, md, err := request_Infrabin_Stream_0(annotatedContext, inboundMarshaler, client, req, pathParams)
+		annotatedContext = runtime.NewServerMetadataContext(annotatedContext, md)
+		if err != nil {
+			runtime.HTTPError(annotatedContext, mux, outboundMarshaler, w, req, err)
+			return
+		}
+		// Invalid requests have already failed in the RPC
+		count, _ := strconv.ParseInt(pathParams["count"], 10, 32)
+		if interval, err := parseStreamInterval(count, req.URL.Query().Get("interval")); err == nil {
+			extendStreamWriteDeadline(http.NewResponseController(w), count, interval)
+		}
+		forward_Infrabin_Stream_0(annotatedContext, mux, outboundMarshaler, w, req, func() (proto.Message, error) { return resp.Recv() }, mux.GetForwardResponseOptions()...)
+	})
+
+	// /bytes/{n} returns the JSON message of RandomData instead of the raw bytes when asked for JSON
+	bytesHandler := httpBodyStreamHandler(mux, client, "/infrabin.Infrabin/Bytes", "/bytes/{n}", request_Infrabin_Bytes_0)
+	randomDataHandler := randomDataJSONHandler(mux, server)
+	mux.Handle(http.MethodGet, pattern_Infrabin_Bytes_0, func(w http.ResponseWriter, req *http.Request, pathParams map[string]string) {
+		if req.URL.Query().Get("format") == "json" || prefersJSON(requestHeader(req.Context(), "Accept")) {
+			randomDataHandler(w, req, pathParams)
+			return
+		}
+		bytesHandler(w, req, pathParams)
+	})
+	mux.Handle(http.MethodGet, pattern_Infrabin_StreamBytes_0, httpBodyStreamHandler(mux, client, "/infrabin.Infrabin/StreamBytes", "/stream-bytes/{n}", request_Infrabin_StreamBytes_0))
+}
+
+// prefersJSON reports whether the Accept header values of /bytes/{n} prefer application/json, with any parameters,
+// to application/octet-stream. Wildcard ranges select the raw bytes.
+func prefersJSON(accept []string) bool {
+	q := map[string]float64{}
+	for _, r := range parseAccept(accept) {
+		if r.mediaType == "application/json" || r.mediaType == "application/octet-stream" {
+			q[r.mediaType] = max(q[r.mediaType], r.q)
+		}
+	}
+	return q["application/json"] > q["application/octet-stream"]
+}
+
+// randomDataJSONHandler returns the gateway handler of the RandomData RPC for the /bytes/{n} endpoint,
+// which returns the random bytes base64-encoded in a JSON message, as /bytes did before streaming raw bytes.
+func randomDataJSONHandler(mux *runtime.ServeMux, server InfrabinServer) runtime.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request, pathParams map[string]string) {
+		ctx, cancel := context.WithCancel(req.Context())
+		defer cancel()
+		_, outboundMarshaler := runtime.MarshalerForRequest(mux, req)
+		annotatedContext, err := runtime.AnnotateIncomingContext(ctx, mux, req, "/infrabin.Infrabin/RandomData", runtime.WithHTTPPathPattern("/bytes/{n}"))
+		if err != nil {
+			runtime.HTTPError(ctx, mux, outboundMarshaler, w, req, err)
+			return
+		}
+		resp, err := requestRandomData(annotatedContext, server, req, pathParams)
+		if err != nil {
+			runtime.HTTPError(annotatedContext, mux, outboundMarshaler, w, req, err)
+			return
+		}
+		runtime.ForwardResponseMessage(annotatedContext, mux, outboundMarshaler, w, req, resp, mux.GetForwardResponseOptions()...)
+	}
+}
+
+// requestRandomData calls the RandomData RPC with the n path parameter and the seed query parameter of /bytes/{n}
+func requestRandomData(ctx context.Context, server InfrabinServer, req *http.Request, pathParams map[string]string) (*Response, error) {
+	n, err := runtime.Int32(pathParams["n"])
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "type mismatch, parameter: %s, error: %v", "n", err)
+	}
+	request := &RandomDataRequest{Path: n}
+	if value := req.URL.Query().Get("seed"); value != "" {
+		seed, err := runtime.Uint64(value)
+		if err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "type mismatch, parameter: %s, error: %v", "seed", err)
+		}
+		request.Seed = &seed
+	}
+	return server.RandomData(ctx, request)
+}
+
+// httpBodyStreamRequest is the gateway request function of a server-streaming RPC of google.api.HttpBody
+type httpBodyStreamRequest func(context.Context, runtime.Marshaler, InfrabinClient, *http.Request, map[string]string) (grpc.ServerStreamingClient[httpbody.HttpBody], runtime.ServerMetadata, error)
+
+// httpBodyStreamHandler returns the gateway handler of a server-streaming RPC of google.api.HttpBody.
+// The chunks are written back to back as the raw body of the response, and the trailers of the RPC,
+// e.g. the throughput of StreamBytes, are sent as HTTP trailers. The X-Request-Id header of the request,
+// generated if missing, is sent back as a response header.
+// The stream is not exempt from the server write timeout, as the body has a fixed size.
+func httpBodyStreamHandler(mux *runtime.ServeMux, client InfrabinClient, method string, path string, request httpBodyStreamRequest) runtime.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request, pathParams map[string]string) {
+		// The trailers do not survive every proxy, the request ID finds the log line of the RPC instead
+		if req.Header.Get(RequestIDHeader) == "" {
+			req.Header.Set(RequestIDHeader, rand.Text())
+			// The RPC reads the headers of the request received by the gateway, see withResponseFormat
+			if original, ok := httpRequestFromContext(req.Context()); ok {
+				original.Header.Set(RequestIDHeader, req.Header.Get(RequestIDHeader))
+			}
+		}
+		w.Header().Set(RequestIDHeader, req.Header.Get(RequestIDHeader))
+
+		ctx, cancel := context.WithCancel(req.Context())
+		defer cancel()
+		inboundMarshaler, outboundMarshaler := runtime.MarshalerForRequest(mux, req)
+		annotatedContext, err := runtime.AnnotateIncomingContext(ctx, mux, req, method, runtime.WithHTTPPathPattern(path))
+		if err != nil {
+			runtime.HTTPError(ctx, mux, outboundMarshaler, w, req, err)
+			return
+		}
+		resp, md, err := request(annotatedContext, inboundMarshaler, client, req, pathParams)
+		annotatedContext = runtime.NewServerMetadataContext(annotatedContext, md)
+		if err != nil {
+			runtime.HTTPError(annotatedContext, mux, outboundMarshaler, w, req, err)
+			return
+		}
+		runtime.ForwardResponseStream(annotatedContext, mux, &rawStreamMarshaler{Marshaler: outboundMarshaler}, w, req, func() (proto.Message, error) { return resp.Recv() }, mux.GetForwardResponseOptions()...)
+		for name, values := range resp.Trailer() {
+			for _, value := range values {
+				w.Header().Add(http.TrailerPrefix+textproto.CanonicalMIMEHeaderKey(name), value)
+			}
+		}
+	}
+}
+
+// rawStreamMarshaler writes the streamed google.api.HttpBody chunks back to back,
+// instead of separating them with the newline delimiter of the gateway.
+type rawStreamMarshaler struct {
+	runtime.Marshaler
+}
+
+func (*rawStreamMarshaler) Delimiter() []byte {
+	return nil
+}
+
+// inProcessStreamClient calls the server-streaming RPCs of an in-process InfrabinServer.
+// Only the server-streaming methods are implemented, the unary ones are called by RegisterInfrabinHandlerServer.
+type inProcessStreamClient struct {
+	InfrabinClient
+	server InfrabinServer
+}
+
+func (c *inProcessStreamClient) Stream(ctx context.Context, in *StreamRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[Response], error) {
+	stream := newInProcessStream[*Response](ctx)
+	go func() {
+		stream.finish(c.server.Stream(in, stream))
+	}()
+	return stream, nil
+}
+
+func (c *inProcessStreamClient) StreamBytes(ctx context.Context, in *StreamBytesRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[httpbody.HttpBody], error) {
+	stream := newInProcessStream[*httpbody.HttpBody](ctx)
+	go func() {
+		stream.finish(c.server.StreamBytes(in, stream))
+	}()
+	return stream, nil
+}
+
+func (c *inProcessStreamClient) Bytes(ctx context.Context, in *BytesRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[httpbody.HttpBody], error) {
+	stream := newInProcessStream[*httpbody.HttpBody](ctx)
+	go func() {
+		stream.finish(c.server.Bytes(in, stream))
+	}()
+	return stream, nil
+}
+
+// inProcessStream connects a server-streaming RPC called in-process to its caller.
+// It implements grpc.ServerStreamingServer for the RPC, and grpc.ServerStreamingClient for the caller,
+// with T the pointer type of the response messages, e.g. *Response.
+type inProcessStream[T proto.Message] struct {
+	ctx       context.Context
+	responses chan T
+	done      chan struct{}
+	// err is the error returned by the RPC, and trailer the trailers it set, only read once done is closed
+	err     error
+	trailer metadata.MD
+}
+
+func newInProcessStream[T proto.Message](ctx context.Context) *inProcessStream[T] {
+	return &inProcessStream[T]{
+		ctx:       ctx,
+		responses: make(chan T),
+		done:      make(chan struct{}),
+	}
+}
+
+// finish ends the stream with the error returned by the RPC
+func (s *inProcessStream[T]) finish(err error) {
+	s.err = err
+	close(s.done)
+}
+
+// Send sends a response to the caller, blocking until it is received or the context is done
+func (s *inProcessStream[T]) Send(response T) error {
+	select {
+	case s.responses <- response:
+		return nil
+	case <-s.ctx.Done():
+		return status.FromContextError(s.ctx.Err()).Err()
+	}
+}
+
+// Recv receives a response from the RPC. Returns io.EOF once the RPC returned successfully.
+func (s *inProcessStream[T]) Recv() (T, error) {
+	var zero T
+	select {
+	case response := <-s.responses:
+		return response, nil
+	case <-s.done:
+		if s.err != nil {
+			return zero, s.err
+		}
+		return zero, io.EOF
+	}
+}
+
+func (s *inProcessStream[T]) Context() context.Context {
+	return s.ctx
+}
+
+func (s *inProcessStream[T]) SendMsg(m any) error {
+	response, ok := m.(T)
+	if !ok {
+		return status.Errorf(codes.Internal, "unexpected message type %T", m)
+	}
+	return s.Send(response)
+}
+
+func (s *inProcessStream[T]) RecvMsg(m any) error {
+	response, err := s.Recv()
+	if err != nil {
+		return err
+	}
+	proto.Merge(m.(proto.Message), response)
+	return nil
+}
+
+// The headers are not forwarded by the in-process gateway
+
+func (s *inProcessStream[T]) SetHeader(metadata.MD) error  { return nil }
+func (s *inProcessStream[T]) SendHeader(metadata.MD) error { return nil }
+func (s *inProcessStream[T]) Header() (metadata.MD, error) { return metadata.MD{}, nil }
+func (s *inProcessStream[T]) CloseSend() error             { return nil }
+
+// SetTrailer sets the trailers of the RPC, which the caller can get once the stream is done
+func (s *inProcessStream[T]) SetTrailer(md metadata.MD) {
+	s.trailer = metadata.Join(s.trailer, md)
+}
+
+// Trailer returns the trailers set by the RPC, once Recv returned an error
+func (s *inProcessStream[T]) Trailer() metadata.MD {
+	select {
+	case <-s.done:
+		return s.trailer
+	default:
+		return metadata.MD{}
+	}
+}
@@ -0,0 +1,165 @@
+package infrabin
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+// UploadBody reads the body of the request into a SHA-256 hash, in chunks so that it is not buffered,
+// throttled to request.Rate. Bodies larger than request.MaxSize are rejected with 413 Content Too Large.
+func (s *InfrabinService) UploadBody(ctx context.Context, request *UploadBodyRequest) (*Response, error) {
+	if request.MaxSize < 0 {
+		return nil, status.Errorf(codes.InvalidArgument, "max_size must not be negative")
+	}
+	rate, err := requestRate(request.Rate)
+	if err != nil {
+		return nil, err
+	}
+
+	var body io.Reader = bytes.NewReader(request.Data)
+	if r, ok := httpRequestFromContext(ctx); ok {
+		body = r.Body
+	}
+	if request.MaxSize > 0 {
+		// Read one more byte to detect larger bodies, without reading all of them
+		body = io.LimitReader(body, request.MaxSize+1)
+	}
+
+	hash := sha256.New()
+	start := time.Now()
+	received, err := throttledCopy(ctx, hash, body, rate, start)
+	elapsed := time.Since(start)
+	switch {
+	case errors.Is(err, os.ErrDeadlineExceeded):
+		return nil, httpStatusError(ctx, http.StatusRequestTimeout, "timeout reading the body after %d bytes", received)
+	case status.Code(err) == codes.Canceled || status.Code(err) == codes.DeadlineExceeded:
+		return nil, err
+	case err != nil:
+		return nil, status.Errorf(codes.InvalidArgument, "cannot read the body after %d bytes: %v", received, err)
+	case request.MaxSize > 0 && received > request.MaxSize:
+		return nil, httpStatusError(ctx, http.StatusRequestEntityTooLarge, "the body is larger than max_size %d", request.MaxSize)
+	}
+
+	achieved := throughput(received, elapsed)
+	log.Printf("Received %d bytes in %s: %s/s", received, elapsed, formatBytes(achieved))
+	hostname, err := os.Hostname()
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "cannot get hostname: %v", err)
+	}
+	return &Response{
+		Hostname: hostname,
+		Upload: &UploadResponse{
+			Bytes:      received,
+			Sha256:     hex.EncodeToString(hash.Sum(nil)),
+			Elapsed:    elapsed.String(),
+			Throughput: int64(achieved),
+		},
+	}, nil
+}
+
+// Upload receives a stream of chunks into a SHA-256 hash until the client closes the stream,
+// and returns the number of messages and bytes received, the elapsed time and the achieved throughput.
+func (s *InfrabinService) Upload(stream grpc.ClientStreamingServer[UploadChunk, UploadResponse]) error {
+	hash := sha256.New()
+	start := time.Now()
+	var messages, received int64
+	for {
+		chunk, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		_, _ = hash.Write(chunk.Data)
+		messages++
+		received += int64(len(chunk.Data))
+	}
+
+	elapsed := time.Since(start)
+	achieved := throughput(received, elapsed)
+	log.Printf("Received %d messages, %d bytes in %s: %s/s", messages, received, elapsed, formatBytes(achieved))
+	return stream.SendAndClose(&UploadResponse{
+		Bytes:      received,
+		Sha256:     hex.EncodeToString(hash.Sum(nil)),
+		Elapsed:    elapsed.String(),
+		Throughput: int64(achieved),
+		Messages:   messages,
+	})
+}
+
+// throttledCopy copies src to dst in chunks, throttled to rate bytes per second since start,
+// and returns the number of bytes copied
+func throttledCopy(ctx context.Context, dst io.Writer, src io.Reader, rate float64, start time.Time) (int64, error) {
+	buf := make([]byte, throttledChunkSize(rate))
+	var copied int64
+	for {
+		n, err := src.Read(buf)
+		if n > 0 {
+			_, _ = dst.Write(buf[:n])
+			copied += int64(n)
+		}
+		if err == io.EOF {
+			return copied, nil
+		}
+		if err != nil {
+			return copied, err
+		}
+		if err := throttle(ctx, start, copied, rate); err != nil {
+			return copied, err
+		}
+	}
+}
+
+// registerInfrabinUploadHandlers registers the UploadBody RPC on the gateway mux, instead of the handlers
+// registered by RegisterInfrabinHandlerServer, which call ParseForm: it would read form-encoded bodies,
+// e.g. from curl --data-binary, before the RPC. The handlers only parse the query parameters.
+func registerInfrabinUploadHandlers(mux *runtime.ServeMux, server InfrabinServer) {
+	for _, binding := range []struct {
+		method  string
+		pattern runtime.Pattern
+		request func(context.Context, runtime.Marshaler, InfrabinServer, *http.Request, map[string]string) (proto.Message, runtime.ServerMetadata, error)
+	}{
+		{http.MethodPost, pattern_Infrabin_UploadBody_0, local_request_Infrabin_UploadBody_0},
+		{http.MethodPut, pattern_Infrabin_UploadBody_1, local_request_Infrabin_UploadBody_1},
+	} {
+		mux.Handle(binding.method, binding.pattern, func(w http.ResponseWriter, req *http.Request, pathParams map[string]string) {
+			// A non-nil PostForm stops ParseForm from reading the body
+			req.PostForm = url.Values{}
+			ctx, cancel := context.WithCancel(req.Context())
+			defer cancel()
+			var stream runtime.ServerTransportStream
+			ctx = grpc.NewContextWithServerTransportStream(ctx, &stream)
+			inboundMarshaler, outboundMarshaler := runtime.MarshalerForRequest(mux, req)
+			annotatedContext, err := runtime.AnnotateIncomingContext(ctx, mux, req, "/infrabin.Infrabin/UploadBody", runtime.WithHTTPPathPattern("/upload"))
+			if err != nil {
+				runtime.HTTPError(ctx, mux, outboundMarshaler, w, req, err)
+				return
+			}
+			resp, md, err := binding.request(annotatedContext, inboundMarshaler, server, req, pathParams)
+			md.HeaderMD, md.TrailerMD = metadata.Join(md.HeaderMD, stream.Header()), metadata.Join(md.TrailerMD, stream.Trailer())
+			annotatedContext = runtime.NewServerMetadataContext(annotatedContext, md)
+			if err != nil {
+				runtime.HTTPError(annotatedContext, mux, outboundMarshaler, w, req, err)
+				return
+			}
+			runtime.ForwardResponseMessage(annotatedContext, mux, outboundMarshaler, w, req, resp, mux.GetForwardResponseOptions()...)
+		})
+	}
+}
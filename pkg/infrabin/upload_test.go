@@ -0,0 +1,100 @@
+package infrabin
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+func TestUploadHandler(t *testing.T) {
+	body := bytes.Repeat([]byte("infrabin"), 1000)
+	sum := sha256.Sum256(body)
+
+	testCases := []struct {
+		name           string
+		method         string
+		path           string
+		contentType    string
+		expectedStatus int
+	}{
+		{name: "post", method: "POST", path: "/upload", contentType: "application/octet-stream", expectedStatus: http.StatusOK},
+		{name: "put", method: "PUT", path: "/upload", expectedStatus: http.StatusOK},
+		{name: "form content type", method: "POST", path: "/upload", contentType: "application/x-www-form-urlencoded", expectedStatus: http.StatusOK},
+		{name: "max size", method: "POST", path: "/upload?max_size=8000", expectedStatus: http.StatusOK},
+		{name: "too large", method: "POST", path: "/upload?max_size=7999", expectedStatus: http.StatusRequestEntityTooLarge},
+		{name: "invalid rate", method: "POST", path: "/upload?rate=fast", expectedStatus: http.StatusBadRequest},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(tc.method, tc.path, bytes.NewReader(body))
+			if tc.contentType != "" {
+				req.Header.Set("Content-Type", tc.contentType)
+			}
+			rr := httptest.NewRecorder()
+			handler := newHTTPInfrabinHandler()
+			handler.ServeHTTP(rr, req)
+
+			if rr.Code != tc.expectedStatus {
+				t.Fatalf("handler returned wrong status code: got %v want %v: %s", rr.Code, tc.expectedStatus, rr.Body.String())
+			}
+			if tc.expectedStatus != http.StatusOK {
+				return
+			}
+			var got Response
+			if err := protojson.Unmarshal(rr.Body.Bytes(), &got); err != nil {
+				t.Fatalf("failed to parse response %v: %v", rr.Body.String(), err)
+			}
+			if got.Upload.GetBytes() != int64(len(body)) || got.Upload.GetSha256() != hex.EncodeToString(sum[:]) {
+				t.Errorf("unexpected upload response: %v", got.Upload)
+			}
+			if _, err := time.ParseDuration(got.Upload.GetElapsed()); err != nil {
+				t.Errorf("invalid elapsed %q: %v", got.Upload.GetElapsed(), err)
+			}
+		})
+	}
+}
+
+func TestUploadHandlerSlowRead(t *testing.T) {
+	// 4000 bytes at 16000 bytes per second take 250ms
+	body := bytes.Repeat([]byte("a"), 4000)
+	req := httptest.NewRequest("POST", "/upload?rate=16KB/s", bytes.NewReader(body))
+	rr := httptest.NewRecorder()
+	handler := newHTTPInfrabinHandler()
+	start := time.Now()
+	handler.ServeHTTP(rr, req)
+	elapsed := time.Since(start)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("handler returned wrong status code: got %v want %v: %s", rr.Code, http.StatusOK, rr.Body.String())
+	}
+	if elapsed < 200*time.Millisecond || elapsed > 2*time.Second {
+		t.Errorf("upload took %v, want about 250ms", elapsed)
+	}
+	var got Response
+	if err := protojson.Unmarshal(rr.Body.Bytes(), &got); err != nil {
+		t.Fatalf("failed to parse response %v: %v", rr.Body.String(), err)
+	}
+	if got.Upload.GetThroughput() > 20000 {
+		t.Errorf("throughput = %d, want at most the rate", got.Upload.GetThroughput())
+	}
+}
+
+func TestUploadBodyGRPC(t *testing.T) {
+	service := &InfrabinService{}
+	response, err := service.UploadBody(context.Background(), &UploadBodyRequest{Data: []byte("infrabin")})
+	if err != nil {
+		t.Fatalf("UploadBody() error = %v", err)
+	}
+	sum := sha256.Sum256([]byte("infrabin"))
+	if response.Upload.GetBytes() != 8 || response.Upload.GetSha256() != hex.EncodeToString(sum[:]) {
+		t.Errorf("unexpected upload response: %v", response.Upload)
+	}
+}
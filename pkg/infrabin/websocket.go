@@ -0,0 +1,117 @@
+package infrabin
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/coder/websocket"
+	"github.com/coder/websocket/wsjson"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// webSocketPush is the message pushed by the server to the WebSocket clients
+type webSocketPush struct {
+	Hostname string `json:"hostname"`
+	Sequence int    `json:"sequence"`
+	Time     string `json:"time"`
+}
+
+// RegisterWebSocket registers a WebSocket echo handler at pattern.
+// The handler echoes every message, and pushes a message with the hostname
+// at the interval set by the push query parameter, if any.
+func RegisterWebSocket(pattern string) HTTPServerOption {
+	return func(ctx context.Context, s *HTTPServer) error {
+		serveMux, ok := s.Server.Handler.(*http.ServeMux)
+		if !ok {
+			return fmt.Errorf("handler is not *http.ServeMux")
+		}
+		serveMux.HandleFunc(pattern, webSocketHandler)
+		return nil
+	}
+}
+
+func webSocketHandler(w http.ResponseWriter, r *http.Request) {
+	var pushInterval time.Duration
+	if value := r.URL.Query().Get("push"); value != "" {
+		var err error
+		if pushInterval, err = parseDelayDuration(value); err != nil || pushInterval < MinStreamInterval {
+			writeStatusError(w, http.StatusBadRequest, status.Errorf(codes.InvalidArgument, "push must be a duration of at least %s: %q", MinStreamInterval, value))
+			return
+		}
+	}
+	hostname, err := os.Hostname()
+	if err != nil {
+		writeStatusError(w, http.StatusInternalServerError, status.Errorf(codes.Internal, "cannot get hostname: %v", err))
+		return
+	}
+
+	// The server read and write timeouts would otherwise close the connection once hijacked
+	rc := http.NewResponseController(w)
+	_ = rc.SetReadDeadline(time.Time{})
+	_ = rc.SetWriteDeadline(time.Time{})
+
+	// Accept any origin, the endpoint is meant to be called from anywhere
+	conn, err := websocket.Accept(w, r, &websocket.AcceptOptions{InsecureSkipVerify: true})
+	if err != nil {
+		// Accept already wrote the error response
+		log.Printf("WebSocket upgrade from %s failed: %v", r.RemoteAddr, err)
+		return
+	}
+	defer conn.CloseNow()
+
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+	if pushInterval > 0 {
+		go pushWebSocket(ctx, conn, hostname, pushInterval)
+	}
+
+	// Reads and writes can be concurrent, so the pushes do not need to be synchronised with the echoes
+	for {
+		messageType, data, err := conn.Read(ctx)
+		if err != nil {
+			reportWebSocketClose(r, err)
+			return
+		}
+		if err := conn.Write(ctx, messageType, data); err != nil {
+			reportWebSocketClose(r, err)
+			return
+		}
+	}
+}
+
+// pushWebSocket pushes a message with the hostname every interval, until the context is done
+func pushWebSocket(ctx context.Context, conn *websocket.Conn, hostname string, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for sequence := 1; ; sequence++ {
+		select {
+		case now := <-ticker.C:
+			push := webSocketPush{Hostname: hostname, Sequence: sequence, Time: now.Format(time.RFC3339Nano)}
+			if err := wsjson.Write(ctx, conn, push); err != nil {
+				return
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// reportWebSocketClose logs the close code of the connection and counts it in the infrabin_websocket_closes_total metric
+func reportWebSocketClose(r *http.Request, err error) {
+	code := websocket.CloseStatus(err)
+	if code == -1 {
+		// The connection was closed without a close frame, e.g. reset by a proxy
+		webSocketClosesTotal.WithLabelValues("none").Inc()
+		log.Printf("WebSocket connection from %s closed without close frame: %v", r.RemoteAddr, err)
+		return
+	}
+	webSocketClosesTotal.WithLabelValues(strconv.Itoa(int(code))).Inc()
+	log.Printf("WebSocket connection from %s closed with status %d (%s)", r.RemoteAddr, code, code)
+}
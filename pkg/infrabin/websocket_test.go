@@ -0,0 +1,122 @@
+package infrabin
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/coder/websocket"
+	"github.com/coder/websocket/wsjson"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func newWebSocketServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	srv, err := NewHTTPServer("test-websocket", RegisterWebSocket("/ws"))
+	if err != nil {
+		t.Fatalf("Failed to create HTTP server: %v", err)
+	}
+	server := httptest.NewServer(srv.Server.Handler)
+	t.Cleanup(server.Close)
+	return server
+}
+
+// webSocketCloses returns the number of WebSocket connections closed with the code, from the default registry
+func webSocketCloses(t *testing.T, code string) float64 {
+	t.Helper()
+	families, err := prometheus.DefaultGatherer.Gather()
+	if err != nil {
+		t.Fatalf("Gather() returned unexpected error: %v", err)
+	}
+	for _, family := range families {
+		if family.GetName() != "infrabin_websocket_closes_total" {
+			continue
+		}
+		for _, metric := range family.GetMetric() {
+			for _, label := range metric.GetLabel() {
+				if label.GetName() == "code" && label.GetValue() == code {
+					return metric.GetCounter().GetValue()
+				}
+			}
+		}
+	}
+	return 0
+}
+
+func TestWebSocketEcho(t *testing.T) {
+	server := newWebSocketServer(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	conn, _, err := websocket.Dial(ctx, strings.Replace(server.URL, "http", "ws", 1)+"/ws", nil)
+	if err != nil {
+		t.Fatalf("Dial() returned unexpected error: %v", err)
+	}
+	defer conn.CloseNow()
+
+	if err := conn.Write(ctx, websocket.MessageText, []byte("hello")); err != nil {
+		t.Fatalf("Write() returned unexpected error: %v", err)
+	}
+	messageType, data, err := conn.Read(ctx)
+	if err != nil {
+		t.Fatalf("Read() returned unexpected error: %v", err)
+	}
+	if messageType != websocket.MessageText || string(data) != "hello" {
+		t.Errorf("Read() = %v %q, want %v %q", messageType, data, websocket.MessageText, "hello")
+	}
+
+	closes := webSocketCloses(t, "4000")
+	if err := conn.Close(websocket.StatusCode(4000), "bye"); err != nil {
+		t.Fatalf("Close() returned unexpected error: %v", err)
+	}
+	// The server reports the close code after the closing handshake
+	deadline := time.Now().Add(time.Second)
+	for webSocketCloses(t, "4000") != closes+1 {
+		if time.Now().After(deadline) {
+			t.Fatalf("close code 4000 was not reported")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestWebSocketPush(t *testing.T) {
+	server := newWebSocketServer(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	conn, _, err := websocket.Dial(ctx, strings.Replace(server.URL, "http", "ws", 1)+"/ws?push=20ms", nil)
+	if err != nil {
+		t.Fatalf("Dial() returned unexpected error: %v", err)
+	}
+	defer conn.CloseNow()
+
+	hostname, _ := os.Hostname()
+	for sequence := 1; sequence <= 2; sequence++ {
+		var push webSocketPush
+		if err := wsjson.Read(ctx, conn, &push); err != nil {
+			t.Fatalf("Read() returned unexpected error: %v", err)
+		}
+		if push.Hostname != hostname || push.Sequence != sequence {
+			t.Errorf("push = %+v, want hostname %s and sequence %d", push, hostname, sequence)
+		}
+	}
+}
+
+func TestWebSocketInvalidPush(t *testing.T) {
+	server := newWebSocketServer(t)
+
+	for _, push := range []string{"abc", "0", "1ns"} {
+		resp, err := http.Get(server.URL + "/ws?push=" + push)
+		if err != nil {
+			t.Fatalf("GET /ws returned unexpected error: %v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("push=%s: handler returned wrong status code: got %v want %v", push, resp.StatusCode, http.StatusBadRequest)
+		}
+	}
+}